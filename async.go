@@ -0,0 +1,57 @@
+package pushnotifications
+
+import (
+	"context"
+)
+
+// A publish running in the background, as started by `PublishToInterestsAsync`.
+type PublishFuture struct {
+	done   chan struct{}
+	cancel context.CancelFunc
+
+	result PublishResult
+	err    error
+}
+
+func (pn *pushNotifications) PublishToInterestsAsync(ctx context.Context, interests []string, request map[string]interface{}) *PublishFuture {
+	return NewPublishFuture(ctx, func(ctx context.Context) (PublishResult, error) {
+		return pn.publishToInterests(ctx, interests, request)
+	})
+}
+
+// Runs `publish` in the background, returning a future for its outcome. The
+// context given to `publish` is cancelled by `PublishFuture.Cancel`. Useful to
+// implement `PublishToInterestsAsync` in a fake of `PushNotifications`.
+func NewPublishFuture(ctx context.Context, publish func(ctx context.Context) (PublishResult, error)) *PublishFuture {
+	ctx, cancel := context.WithCancel(ctx)
+	future := &PublishFuture{
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+
+	go func() {
+		defer close(future.done)
+		defer cancel()
+		future.result, future.err = publish(ctx)
+	}()
+
+	return future
+}
+
+// Waits for the publish to finish and returns its outcome, as
+// `PublishToInterestsWithResult` would have.
+func (f *PublishFuture) Result() (PublishResult, error) {
+	<-f.done
+	return f.result, f.err
+}
+
+// Returns a channel that's closed once the publish has finished.
+func (f *PublishFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Aborts the publish if it's still in flight, in which case `Result` returns
+// an error wrapping `context.Canceled`. Does nothing once it has finished.
+func (f *PublishFuture) Cancel() {
+	f.cancel()
+}
@@ -0,0 +1,68 @@
+package pushnotifications
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPublishToInterestsAsync(t *testing.T) {
+	Convey("A Push Notifications Instance publishing asynchronously", t, func() {
+		release := make(chan struct{})
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+				return
+			}
+			w.Write([]byte(`{"publishId":"pub-123"}`))
+		}))
+		defer testServer.Close()
+
+		pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL))
+		So(err, ShouldBeNil)
+
+		Convey("should return the result once the publish has finished", func() {
+			future := pn.PublishToInterestsAsync(context.Background(), []string{"hello"}, testPublishRequest)
+
+			time.Sleep(20 * time.Millisecond)
+			select {
+			case <-future.Done():
+				So("the publish finished before the server responded", ShouldBeEmpty)
+			default:
+			}
+			close(release)
+
+			result, err := future.Result()
+			So(err, ShouldBeNil)
+			So(result.PublishId, ShouldEqual, "pub-123")
+		})
+
+		Convey("should abort a slow publish when cancelled", func() {
+			defer close(release)
+			future := pn.PublishToInterestsAsync(context.Background(), []string{"hello"}, testPublishRequest)
+			time.Sleep(20 * time.Millisecond)
+
+			start := time.Now()
+			future.Cancel()
+			result, err := future.Result()
+			So(time.Since(start), ShouldBeLessThan, time.Second)
+			So(result.PublishId, ShouldEqual, "")
+			So(errors.Is(err, context.Canceled), ShouldBeTrue)
+			So(err.Error(), ShouldContainSubstring, "cancelled or timed out")
+		})
+
+		Convey("should report validation errors through the future", func() {
+			future := pn.PublishToInterestsAsync(context.Background(), nil, testPublishRequest)
+
+			_, err := future.Result()
+			So(errors.Is(err, ErrNoInterests), ShouldBeTrue)
+			future.Cancel()
+		})
+	})
+}
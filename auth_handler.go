@@ -0,0 +1,40 @@
+package pushnotifications
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Returns an `http.Handler` for the endpoint the Beams client SDKs get tokens
+// from, such as `/pusher/beams-auth`. `authorize` checks the request as your
+// app normally would, returning the id of the signed in user, or false to
+// refuse the request with 401 Unauthorized. The client SDKs send the user id
+// they want a token for in the `user_id` query parameter, and requests for
+// any other user are refused with 401 Unauthorized too.
+func BeamsAuthHandler(pn PushNotifications, authorize func(r *http.Request) (userId string, ok bool)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId, ok := authorize(r)
+		if !ok || userId != r.URL.Query().Get("user_id") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		beamsToken, err := pn.GenerateToken(userId)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		beamsTokenJson, err := json.Marshal(beamsToken)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		// The token is a credential for the user, so must not be cached.
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		w.Write(beamsTokenJson)
+	})
+}
@@ -0,0 +1,55 @@
+package pushnotifications
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBeamsAuthHandler(t *testing.T) {
+	Convey("A Beams auth handler", t, func() {
+		pn, err := New(testInstanceId, testSecretKey)
+		So(err, ShouldBeNil)
+
+		signedInUser := "u-123"
+		handler := BeamsAuthHandler(pn, func(r *http.Request) (string, bool) {
+			return signedInUser, signedInUser != ""
+		})
+		get := func(url string) *httptest.ResponseRecorder {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, url, nil))
+			return recorder
+		}
+
+		Convey("should return a token for the signed in user", func() {
+			response := get("/pusher/beams-auth?user_id=u-123")
+			So(response.Code, ShouldEqual, http.StatusOK)
+			So(response.Header().Get("Content-Type"), ShouldEqual, "application/json")
+			So(response.Header().Get("Cache-Control"), ShouldEqual, "no-store")
+
+			body := map[string]string{}
+			So(json.Unmarshal(response.Body.Bytes(), &body), ShouldBeNil)
+			userId, err := pn.VerifyToken(body["token"])
+			So(err, ShouldBeNil)
+			So(userId, ShouldEqual, "u-123")
+		})
+
+		Convey("should refuse a request the app doesn't authorize", func() {
+			signedInUser = ""
+			So(get("/pusher/beams-auth?user_id=u-123").Code, ShouldEqual, http.StatusUnauthorized)
+		})
+
+		Convey("should refuse a request for another user", func() {
+			So(get("/pusher/beams-auth?user_id=u-456").Code, ShouldEqual, http.StatusUnauthorized)
+			So(get("/pusher/beams-auth").Code, ShouldEqual, http.StatusUnauthorized)
+		})
+
+		Convey("should fail if the token can't be generated", func() {
+			signedInUser = string([]byte{0xff})
+			So(get("/pusher/beams-auth?user_id=%FF").Code, ShouldEqual, http.StatusInternalServerError)
+		})
+	})
+}
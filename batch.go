@@ -0,0 +1,161 @@
+package pushnotifications
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// An at-a-glance summary of a batched publish.
+type BatchSummary struct {
+	// The number of user ids given.
+	Total int
+	// The number of user ids in chunks that were published successfully.
+	Succeeded int
+	// The number of user ids in chunks that failed to publish.
+	Failed int
+	// The publish ids of the successful chunks, in order.
+	PublishIds []string
+	// The results of the successful chunks, in order.
+	Results []PublishResult
+	// The errors of the failed chunks, in order.
+	Errors []error
+	// The outcome of every chunk, in order.
+	Chunks []ChunkResult
+}
+
+// The outcome of publishing one chunk of a batched publish.
+type ChunkResult struct {
+	// The user ids in the chunk.
+	Users []string
+	// The publish id, if the chunk was published.
+	PublishId string
+	// Why the chunk failed, if it did.
+	Error error
+}
+
+func (pn *pushNotifications) PublishToUsersBatched(users []string, request map[string]interface{}) (BatchSummary, error) {
+	if len(users) == 0 {
+		return BatchSummary{}, pn.validationFailed(ruleNoUsers, len(users), errors.Wrap(ErrNoUsers, "Must supply at least one user id"))
+	}
+
+	return PublishUsersInChunks(users, pn.maxUsersPerPublish, func(chunk []string) (PublishResult, error) {
+		return pn.publishToUsers(context.Background(), chunk, request)
+	})
+}
+
+// Publishes to `users` in chunks of up to `chunkSize`, calling `publish` for
+// each chunk, and summarises the outcome as `PublishToUsersBatched` does:
+// every chunk is attempted, and the returned error wraps the first failure.
+// Useful to implement `PublishToUsersBatched` in a fake of `PushNotifications`.
+func PublishUsersInChunks(users []string, chunkSize int, publish func(users []string) (PublishResult, error)) (BatchSummary, error) {
+	if chunkSize <= 0 {
+		return BatchSummary{}, errors.Errorf("Chunk size must be positive, got %d", chunkSize)
+	}
+
+	summary := BatchSummary{Total: len(users)}
+	for start := 0; start < len(users); start += chunkSize {
+		end := start + chunkSize
+		if end > len(users) {
+			end = len(users)
+		}
+		chunk := users[start:end]
+
+		result, err := publish(chunk)
+		if err != nil {
+			err = errors.Wrapf(err, "Failed to publish to users %d to %d", start, end-1)
+			summary.Failed += len(chunk)
+			summary.Errors = append(summary.Errors, err)
+			summary.Chunks = append(summary.Chunks, ChunkResult{Users: chunk, Error: err})
+			continue
+		}
+
+		summary.Succeeded += len(chunk)
+		summary.PublishIds = append(summary.PublishIds, result.PublishId)
+		summary.Results = append(summary.Results, result)
+		summary.Chunks = append(summary.Chunks, ChunkResult{Users: chunk, PublishId: result.PublishId})
+	}
+
+	if summary.Failed > 0 {
+		return summary, errors.Wrapf(summary.Errors[0], "Failed to publish to %d of %d users", summary.Failed, summary.Total)
+	}
+	return summary, nil
+}
+
+func (pn *pushNotifications) PublishToInterestsBatched(interests []string, request map[string]interface{}) ([]string, error) {
+	if len(interests) == 0 {
+		return nil, pn.validationFailed(ruleNoInterests, len(interests), errors.Wrap(ErrNoInterests, "No interests were supplied"))
+	}
+	// Checked before anything is allocated, to fail fast on runaway inputs.
+	if pn.maxTotalInterests > 0 && len(interests) > pn.maxTotalInterests {
+		return nil, pn.validationFailed(ruleTooManyInterests, len(interests), errors.Wrapf(ErrTooManyInterests,
+			"Too many interests supplied (%d): batched publishes are limited to %d", len(interests), pn.maxTotalInterests))
+	}
+
+	return PublishInterestsInChunks(interests, pn.maxInterests, pn.continueOnBatchError, func(chunk []string) (PublishResult, error) {
+		return pn.publishToInterests(context.Background(), chunk, request)
+	})
+}
+
+// Publishes to `interests` in chunks of up to `chunkSize`, calling `publish`
+// for each chunk, as `PublishToInterestsBatched` does: it stops at the first
+// failure, unless `continueOnError` is set, in which case the failures are
+// returned together in a `*BatchError`. Useful to implement
+// `PublishToInterestsBatched` in a fake of `PushNotifications`.
+func PublishInterestsInChunks(interests []string, chunkSize int, continueOnError bool, publish func(interests []string) (PublishResult, error)) ([]string, error) {
+	if chunkSize <= 0 {
+		return nil, errors.Errorf("Chunk size must be positive, got %d", chunkSize)
+	}
+
+	publishIds := make([]string, 0, (len(interests)+chunkSize-1)/chunkSize)
+	batchErr := &BatchError{}
+	for start := 0; start < len(interests); start += chunkSize {
+		end := start + chunkSize
+		if end > len(interests) {
+			end = len(interests)
+		}
+
+		result, err := publish(interests[start:end])
+		if err != nil {
+			err = errors.Wrapf(err, "Failed to publish to interests %d to %d", start, end-1)
+			if !continueOnError {
+				return publishIds, err
+			}
+			batchErr.Errors = append(batchErr.Errors, err)
+		}
+
+		publishIds = append(publishIds, result.PublishId)
+	}
+
+	if len(batchErr.Errors) > 0 {
+		batchErr.Chunks = len(publishIds)
+		return publishIds, batchErr
+	}
+	return publishIds, nil
+}
+
+// The errors of every chunk that failed in a batched publish that carried on
+// past failures, as set with `WithContinueOnBatchError`.
+type BatchError struct {
+	// The number of chunks published or attempted.
+	Chunks int
+	// The errors of the failed chunks, in order.
+	Errors []error
+}
+
+func (e *BatchError) Error() string {
+	if len(e.Errors) == 0 {
+		return "Batched publish failed"
+	}
+	return fmt.Sprintf("%d of %d chunks failed, the first with: %s", len(e.Errors), e.Chunks, e.Errors[0])
+}
+
+// Returns the error of the first failed chunk, so that `errors.Is` and
+// `errors.As` look at it, or nil if there is none.
+func (e *BatchError) Unwrap() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e.Errors[0]
+}
@@ -0,0 +1,204 @@
+package pushnotifications
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPublishToUsersBatched(t *testing.T) {
+	Convey("A Push Notifications Instance publishing to users in batches", t, func() {
+		var requests int32
+		var failingChunk int32 = -1
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			chunk := atomic.AddInt32(&requests, 1) - 1
+			body := struct {
+				Users []string `json:"users"`
+			}{}
+			bodyBytes, _ := ioutil.ReadAll(r.Body)
+			json.Unmarshal(bodyBytes, &body)
+
+			if chunk == atomic.LoadInt32(&failingChunk) {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"Bad Request","description":"nope"}`))
+				return
+			}
+			w.Write([]byte(fmt.Sprintf(`{"publishId":"pub-%d-%d"}`, chunk, len(body.Users))))
+		}))
+		defer testServer.Close()
+
+		pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL))
+		So(err, ShouldBeNil)
+
+		users := make([]string, 2500)
+		for i := range users {
+			users[i] = fmt.Sprintf("u-%d", i)
+		}
+
+		Convey("should publish every chunk of users", func() {
+			summary, err := pn.PublishToUsersBatched(users, testPublishRequest)
+			So(err, ShouldBeNil)
+			So(summary.Total, ShouldEqual, 2500)
+			So(summary.Succeeded, ShouldEqual, 2500)
+			So(summary.Failed, ShouldEqual, 0)
+			So(summary.PublishIds, ShouldResemble, []string{"pub-0-1000", "pub-1-1000", "pub-2-500"})
+			So(summary.Results, ShouldHaveLength, 3)
+			So(summary.Errors, ShouldBeEmpty)
+		})
+
+		Convey("should summarise the chunks that failed", func() {
+			atomic.StoreInt32(&failingChunk, 1)
+
+			summary, err := pn.PublishToUsersBatched(users, testPublishRequest)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, "Failed to publish to 1000 of 2500 users")
+			var apiError *APIError
+			So(errors.As(err, &apiError), ShouldBeTrue)
+			So(apiError.StatusCode, ShouldEqual, http.StatusBadRequest)
+
+			So(summary.Total, ShouldEqual, 2500)
+			So(summary.Succeeded, ShouldEqual, 1500)
+			So(summary.Failed, ShouldEqual, 1000)
+			So(summary.PublishIds, ShouldResemble, []string{"pub-0-1000", "pub-2-500"})
+			So(summary.Results, ShouldHaveLength, 2)
+			So(summary.Results[1].PublishId, ShouldEqual, "pub-2-500")
+			So(summary.Errors, ShouldHaveLength, 1)
+			So(summary.Errors[0].Error(), ShouldContainSubstring, "Failed to publish to users 1000 to 1999")
+			So(summary.Errors[0].Error(), ShouldContainSubstring, "nope")
+
+			So(summary.Chunks, ShouldHaveLength, 3)
+			So(summary.Chunks[0].Users, ShouldResemble, users[:1000])
+			So(summary.Chunks[0].PublishId, ShouldEqual, "pub-0-1000")
+			So(summary.Chunks[0].Error, ShouldBeNil)
+			So(summary.Chunks[1].Users, ShouldResemble, users[1000:2000])
+			So(summary.Chunks[1].PublishId, ShouldEqual, "")
+			So(summary.Chunks[1].Error, ShouldEqual, summary.Errors[0])
+			So(summary.Chunks[2].Users, ShouldResemble, users[2000:])
+			So(summary.Chunks[2].PublishId, ShouldEqual, "pub-2-500")
+		})
+
+		Convey("should fail if no users are given", func() {
+			_, err := pn.PublishToUsersBatched(nil, testPublishRequest)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Must supply at least one user id")
+		})
+	})
+}
+
+func TestPublishToInterestsBatched(t *testing.T) {
+	Convey("A Push Notifications Instance publishing to interests in batches", t, func() {
+		var requests int32
+		var failingChunk int32 = -1
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			chunk := atomic.AddInt32(&requests, 1) - 1
+			body := struct {
+				Interests []string `json:"interests"`
+			}{}
+			bodyBytes, _ := ioutil.ReadAll(r.Body)
+			json.Unmarshal(bodyBytes, &body)
+
+			if chunk == atomic.LoadInt32(&failingChunk) {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"Bad Request","description":"nope"}`))
+				return
+			}
+			w.Write([]byte(fmt.Sprintf(`{"publishId":"pub-%d-%d"}`, chunk, len(body.Interests))))
+		}))
+		defer testServer.Close()
+
+		pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL), WithMaxTotalInterests(1000))
+		So(err, ShouldBeNil)
+
+		interests := make([]string, 250)
+		for i := range interests {
+			interests[i] = fmt.Sprintf("interest-%d", i)
+		}
+
+		Convey("should publish every chunk of interests", func() {
+			publishIds, err := pn.PublishToInterestsBatched(interests, testPublishRequest)
+			So(err, ShouldBeNil)
+			So(publishIds, ShouldResemble, []string{"pub-0-100", "pub-1-100", "pub-2-50"})
+		})
+
+		Convey("should stop at the first chunk that fails", func() {
+			atomic.StoreInt32(&failingChunk, 1)
+
+			publishIds, err := pn.PublishToInterestsBatched(interests, testPublishRequest)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Failed to publish to interests 100 to 199")
+			So(publishIds, ShouldResemble, []string{"pub-0-100"})
+			So(atomic.LoadInt32(&requests), ShouldEqual, 2)
+		})
+
+		Convey("using `WithContinueOnBatchError`, it", func() {
+			atomic.StoreInt32(&failingChunk, 1)
+			pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL), WithContinueOnBatchError())
+			So(err, ShouldBeNil)
+
+			Convey("should publish every chunk and collect the failures", func() {
+				publishIds, err := pn.PublishToInterestsBatched(interests, testPublishRequest)
+				So(publishIds, ShouldResemble, []string{"pub-0-100", "", "pub-2-50"})
+				So(atomic.LoadInt32(&requests), ShouldEqual, 3)
+
+				var batchErr *BatchError
+				So(errors.As(err, &batchErr), ShouldBeTrue)
+				So(batchErr.Chunks, ShouldEqual, 3)
+				So(batchErr.Errors, ShouldHaveLength, 1)
+				So(err.Error(), ShouldStartWith, "1 of 3 chunks failed, the first with: Failed to publish to interests 100 to 199")
+
+				var apiError *APIError
+				So(errors.As(err, &apiError), ShouldBeTrue)
+				So(apiError.StatusCode, ShouldEqual, http.StatusBadRequest)
+			})
+
+			Convey("should describe a batch error without any chunk errors", func() {
+				batchErr := &BatchError{}
+				So(batchErr.Error(), ShouldEqual, "Batched publish failed")
+				So(batchErr.Unwrap(), ShouldBeNil)
+				So(errors.Is(batchErr, ErrNoInterests), ShouldBeFalse)
+			})
+		})
+
+		Convey("should publish chunks of the size set with `WithMaxInterests`", func() {
+			pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL), WithMaxInterests(125))
+			So(err, ShouldBeNil)
+
+			publishIds, err := pn.PublishToInterestsBatched(interests, testPublishRequest)
+			So(err, ShouldBeNil)
+			So(publishIds, ShouldResemble, []string{"pub-0-125", "pub-1-125"})
+		})
+
+		Convey("should fail if no interests are given", func() {
+			_, err := pn.PublishToInterestsBatched(nil, testPublishRequest)
+			So(errors.Is(err, ErrNoInterests), ShouldBeTrue)
+		})
+
+		Convey("should fail fast on more interests than `WithMaxTotalInterests` allows", func() {
+			enormous := make([]string, 1<<20)
+
+			var publishIds []string
+			allocs := testing.AllocsPerRun(10, func() {
+				publishIds, err = pn.PublishToInterestsBatched(enormous, testPublishRequest)
+			})
+			So(errors.Is(err, ErrTooManyInterests), ShouldBeTrue)
+			So(err.Error(), ShouldContainSubstring, "batched publishes are limited to 1000")
+			So(publishIds, ShouldBeNil)
+			// A handful for the error, rather than one per chunk.
+			So(allocs, ShouldBeLessThan, 20)
+			So(atomic.LoadInt32(&requests), ShouldEqual, 0)
+		})
+
+		Convey("should not create an instance with a non-positive limit", func() {
+			pn, err := New(testInstanceId, testSecretKey, WithMaxTotalInterests(0))
+			So(pn, ShouldBeNil)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,178 @@
+package pushnotifications
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Runs publishes and user deletions in the background on a shared pool of
+// workers, e.g. for a maintenance job that does both. Work is queued without
+// blocking, and started in the order it was queued as workers become free.
+// Work cancelled while queued is skipped when it reaches a worker.
+// Create one with `NewBatcher`.
+type Batcher struct {
+	funcs      BatcherFuncs
+	maxWorkers int
+
+	mu      sync.Mutex
+	queue   []func()
+	workers int
+	pending sync.WaitGroup
+}
+
+// A user deletion queued on a `Batcher`.
+type DeleteUserFuture struct {
+	done   chan struct{}
+	cancel context.CancelFunc
+
+	err error
+}
+
+// The calls a `Batcher` runs on its workers.
+type BatcherFuncs struct {
+	PublishToInterests func(ctx context.Context, interests []string, request map[string]interface{}) (PublishResult, error)
+	PublishToUsers     func(ctx context.Context, users []string, request map[string]interface{}) (PublishResult, error)
+	DeleteUser         func(ctx context.Context, userId string) error
+}
+
+func (pn *pushNotifications) NewBatcher(workers int) *Batcher {
+	return NewBatcherFuncs(BatcherFuncs{
+		PublishToInterests: pn.publishToInterests,
+		PublishToUsers:     pn.publishToUsers,
+		DeleteUser:         pn.DeleteUserWithContext,
+	}, workers)
+}
+
+// Creates a `Batcher` running `funcs` on up to `workers` workers at once, or
+// `GOMAXPROCS` if `workers` isn't positive. Useful to implement `NewBatcher`
+// in a fake of `PushNotifications`.
+func NewBatcherFuncs(funcs BatcherFuncs, workers int) *Batcher {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	return &Batcher{
+		funcs:      funcs,
+		maxWorkers: workers,
+	}
+}
+
+// Queues a publish to `interests`, like `PublishToInterestsAsync`.
+func (b *Batcher) PublishToInterests(ctx context.Context, interests []string, request map[string]interface{}) *PublishFuture {
+	return b.publish(ctx, func(ctx context.Context) (PublishResult, error) {
+		return b.funcs.PublishToInterests(ctx, interests, request)
+	})
+}
+
+// Queues a publish to `users`.
+func (b *Batcher) PublishToUsers(ctx context.Context, users []string, request map[string]interface{}) *PublishFuture {
+	return b.publish(ctx, func(ctx context.Context) (PublishResult, error) {
+		return b.funcs.PublishToUsers(ctx, users, request)
+	})
+}
+
+func (b *Batcher) publish(ctx context.Context, publish func(ctx context.Context) (PublishResult, error)) *PublishFuture {
+	ctx, cancel := context.WithCancel(ctx)
+	future := &PublishFuture{
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+
+	b.enqueue(func() {
+		defer close(future.done)
+		defer cancel()
+		if future.err = queuedContextErr(ctx); future.err != nil {
+			return
+		}
+		future.result, future.err = publish(ctx)
+	})
+	return future
+}
+
+// Queues the deletion of the user `userId`.
+func (b *Batcher) DeleteUser(ctx context.Context, userId string) *DeleteUserFuture {
+	ctx, cancel := context.WithCancel(ctx)
+	future := &DeleteUserFuture{
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+
+	b.enqueue(func() {
+		defer close(future.done)
+		defer cancel()
+		if future.err = queuedContextErr(ctx); future.err != nil {
+			return
+		}
+		future.err = b.funcs.DeleteUser(ctx, userId)
+	})
+
+	return future
+}
+
+// Waits for all the work queued so far to finish. More work can be queued
+// afterwards.
+func (b *Batcher) Wait() {
+	b.pending.Wait()
+}
+
+// Adds `task` to the back of the queue, starting a worker for it unless
+// `maxWorkers` are running already.
+func (b *Batcher) enqueue(task func()) {
+	b.pending.Add(1)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.queue = append(b.queue, task)
+	if b.workers < b.maxWorkers {
+		b.workers++
+		go b.work()
+	}
+}
+
+// Runs queued tasks in order until the queue is empty.
+func (b *Batcher) work() {
+	for {
+		b.mu.Lock()
+		if len(b.queue) == 0 {
+			b.workers--
+			b.mu.Unlock()
+			return
+		}
+		task := b.queue[0]
+		b.queue[0] = nil
+		b.queue = b.queue[1:]
+		b.mu.Unlock()
+
+		task()
+		b.pending.Done()
+	}
+}
+
+// Returns an error if `ctx` was done while its work was queued.
+func queuedContextErr(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "Gave up waiting for a free worker because the context was cancelled or timed out")
+	}
+	return nil
+}
+
+// Waits for the deletion to finish and returns its outcome, as
+// `DeleteUserWithContext` would have.
+func (f *DeleteUserFuture) Err() error {
+	<-f.done
+	return f.err
+}
+
+// Returns a channel that's closed once the deletion has finished.
+func (f *DeleteUserFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Aborts the deletion if it's queued or in flight, in which case `Err`
+// returns an error wrapping `context.Canceled`. Does nothing once it has
+// finished.
+func (f *DeleteUserFuture) Cancel() {
+	f.cancel()
+}
@@ -0,0 +1,125 @@
+package pushnotifications
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBatcher(t *testing.T) {
+	Convey("A Batcher", t, func() {
+		var inFlight, maxInFlight int32
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			current := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				max := atomic.LoadInt32(&maxInFlight)
+				if current <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, current) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+
+			switch {
+			case strings.HasSuffix(r.URL.Path, "/users/u-missing"):
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"Bad Request","description":"nope"}`))
+			case r.Method == http.MethodPost:
+				w.Write([]byte(`{"publishId":"pub-123"}`))
+			}
+		}))
+		defer testServer.Close()
+
+		pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL))
+		So(err, ShouldBeNil)
+		batcher := pn.NewBatcher(2)
+
+		Convey("should run a mix of publishes and deletions on a bounded number of workers", func() {
+			ctx := context.Background()
+			var publishes []*PublishFuture
+			var deletions []*DeleteUserFuture
+			for i := 0; i < 3; i++ {
+				publishes = append(publishes, batcher.PublishToInterests(ctx, []string{"hello"}, testPublishRequest))
+				publishes = append(publishes, batcher.PublishToUsers(ctx, []string{"u-123"}, testPublishRequest))
+				deletions = append(deletions, batcher.DeleteUser(ctx, "u-123"))
+			}
+			deletions = append(deletions, batcher.DeleteUser(ctx, "u-missing"))
+			invalid := batcher.PublishToInterests(ctx, []string{}, testPublishRequest)
+			batcher.Wait()
+
+			for _, future := range publishes {
+				So(future.Done(), shouldBeClosed)
+				result, err := future.Result()
+				So(err, ShouldBeNil)
+				So(result.PublishId, ShouldEqual, "pub-123")
+			}
+			for _, future := range deletions[:3] {
+				So(future.Done(), shouldBeClosed)
+				So(future.Err(), ShouldBeNil)
+			}
+			So(deletions[3].Err(), ShouldNotBeNil)
+			_, err := invalid.Result()
+			So(errors.Is(err, ErrNoInterests), ShouldBeTrue)
+
+			So(atomic.LoadInt32(&maxInFlight), ShouldEqual, 2)
+		})
+
+		Convey("should fail work cancelled while queued", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			deletion := batcher.DeleteUser(ctx, "u-123")
+			publish := batcher.PublishToUsers(ctx, []string{"u-123"}, testPublishRequest)
+			batcher.Wait()
+
+			So(errors.Is(deletion.Err(), context.Canceled), ShouldBeTrue)
+			_, err := publish.Result()
+			So(errors.Is(err, context.Canceled), ShouldBeTrue)
+		})
+
+		Convey("should start work in the order it was queued", func() {
+			var started []string
+			orderedBatcher := NewBatcherFuncs(BatcherFuncs{
+				PublishToUsers: func(ctx context.Context, users []string, request map[string]interface{}) (PublishResult, error) {
+					started = append(started, users[0])
+					return PublishResult{}, nil
+				},
+				DeleteUser: func(ctx context.Context, userId string) error {
+					started = append(started, userId)
+					return nil
+				},
+			}, 1)
+
+			var expected []string
+			for i := 0; i < 50; i++ {
+				userId := fmt.Sprintf("u-%d", i)
+				expected = append(expected, userId)
+				if i%2 == 0 {
+					orderedBatcher.PublishToUsers(context.Background(), []string{userId}, testPublishRequest)
+				} else {
+					orderedBatcher.DeleteUser(context.Background(), userId)
+				}
+			}
+			orderedBatcher.Wait()
+
+			So(started, ShouldResemble, expected)
+		})
+	})
+}
+
+func shouldBeClosed(actual interface{}, expected ...interface{}) string {
+	select {
+	case <-actual.(<-chan struct{}):
+		return ""
+	default:
+		return "Expected the channel to be closed"
+	}
+}
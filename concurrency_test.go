@@ -0,0 +1,49 @@
+package pushnotifications
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// Run with `go test -race` to catch data races on the shared request map.
+func TestConcurrentPublishesWithSharedRequest(t *testing.T) {
+	Convey("A Push Notifications Instance publishing concurrently", t, func() {
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"publishId":"pub-123"}`))
+		}))
+		defer testServer.Close()
+
+		pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL))
+		So(err, ShouldBeNil)
+
+		Convey("should not race or panic when every publish shares the same request map", func() {
+			sharedRequest := map[string]interface{}{"fcm": testPublishRequest["fcm"]}
+
+			var wg sync.WaitGroup
+			errs := make(chan error, 50)
+			for i := 0; i < 25; i++ {
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					_, err := pn.PublishToInterests([]string{"hello"}, sharedRequest)
+					errs <- err
+				}()
+				go func() {
+					defer wg.Done()
+					_, err := pn.PublishToUsers([]string{"u-123"}, sharedRequest)
+					errs <- err
+				}()
+			}
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				So(err, ShouldBeNil)
+			}
+		})
+	})
+}
@@ -0,0 +1,106 @@
+package pushnotifications
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// An error response from the Beams API.
+// Failed publishes and user deletions return it wrapped, so use `errors.As`
+// (or `errors.Cause`) to get at it.
+type APIError struct {
+	// The HTTP status code of the response.
+	StatusCode int
+	// The `error` field of the response body.
+	Code string
+	// The `description` field of the response body.
+	Description string
+	// The `X-Request-Id` header of the response, if any.
+	RequestId string
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" && e.Description == "" {
+		return fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+// The phases of a request a `TimeoutError` can happen in.
+const (
+	// Connecting to the Beams API, including the TLS handshake.
+	TimeoutPhaseConnect = "connect"
+	// Sending the request, or waiting for or reading the response.
+	TimeoutPhaseRead = "read"
+)
+
+// A request to the Beams API that timed out, e.g. due to `WithRequestTimeout`
+// or `WithPerAttemptTimeout`. Failed publishes and user deletions return it
+// wrapped, so use `errors.As` to get at it.
+type TimeoutError struct {
+	// When the request timed out: `TimeoutPhaseConnect` or `TimeoutPhaseRead`.
+	Phase string
+	// The error the request failed with.
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Phase == TimeoutPhaseConnect {
+		return "timed out connecting: " + e.Err.Error()
+	}
+	return "timed out waiting for the response: " + e.Err.Error()
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Always true, so that a `TimeoutError` satisfies the
+// `interface{ Timeout() bool }` check callers use to detect timeouts.
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// Wraps `err` in a `TimeoutError` if it's a timeout, leaving other errors as
+// they are. `connected` tells whether the request had a connection yet.
+func asTimeoutError(err error, connected bool) error {
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		return err
+	}
+
+	phase := TimeoutPhaseRead
+	if !connected {
+		phase = TimeoutPhaseConnect
+	}
+	return &TimeoutError{Phase: phase, Err: err}
+}
+
+// Hides all but the start of `value`, for error messages and logs.
+func redact(value string) string {
+	const visible = 4
+	if len(value) <= visible {
+		return "***"
+	}
+
+	return value[:visible] + "***"
+}
+
+// Escapes invalid UTF-8 and non-printable characters in `value`, so that
+// user input can be echoed in error messages without garbling logs.
+func printable(value string) string {
+	if utf8.ValidString(value) && strings.IndexFunc(value, func(r rune) bool { return !unicode.IsPrint(r) }) == -1 {
+		return value
+	}
+
+	quoted := strconv.Quote(value)
+	return quoted[1 : len(quoted)-1]
+}
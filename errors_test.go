@@ -0,0 +1,79 @@
+package pushnotifications
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTimeoutError(t *testing.T) {
+	Convey("A request that times out", t, func() {
+		Convey("while connecting should fail with a connect timeout", func() {
+			// Accepts connections but never answers the TLS handshake.
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			So(err, ShouldBeNil)
+			defer listener.Close()
+			go func() {
+				for {
+					conn, err := listener.Accept()
+					if err != nil {
+						return
+					}
+					defer conn.Close()
+				}
+			}()
+
+			pn, err := New(testInstanceId, testSecretKey,
+				WithCustomBaseURL("https://"+listener.Addr().String()),
+				WithRequestTimeout(50*time.Millisecond),
+			)
+			So(err, ShouldBeNil)
+
+			_, err = pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+			var timeoutErr *TimeoutError
+			So(errors.As(err, &timeoutErr), ShouldBeTrue)
+			So(timeoutErr.Phase, ShouldEqual, TimeoutPhaseConnect)
+			So(err.Error(), ShouldContainSubstring, "due to a network error: timed out connecting")
+
+			var netErr net.Error
+			So(errors.As(err, &netErr), ShouldBeTrue)
+			So(netErr.Timeout(), ShouldBeTrue)
+		})
+
+		Convey("while waiting for the response should fail with a read timeout", func() {
+			testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(200 * time.Millisecond)
+			}))
+			defer testServer.Close()
+
+			pn, err := New(testInstanceId, testSecretKey,
+				WithCustomBaseURL(testServer.URL),
+				WithRequestTimeout(50*time.Millisecond),
+			)
+			So(err, ShouldBeNil)
+
+			err = pn.DeleteUser("u-123")
+			var timeoutErr *TimeoutError
+			So(errors.As(err, &timeoutErr), ShouldBeTrue)
+			So(timeoutErr.Phase, ShouldEqual, TimeoutPhaseRead)
+		})
+
+		Convey("should not be a `TimeoutError` if it fails otherwise", func() {
+			testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			testServer.Close()
+
+			pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL))
+			So(err, ShouldBeNil)
+
+			_, err = pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+			So(err, ShouldNotBeNil)
+			var timeoutErr *TimeoutError
+			So(errors.As(err, &timeoutErr), ShouldBeFalse)
+		})
+	})
+}
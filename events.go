@@ -0,0 +1,55 @@
+package pushnotifications
+
+import (
+	"fmt"
+	"time"
+)
+
+// The kind of operation an `Event` reports.
+type EventType string
+
+const (
+	EventPublish       EventType = "publish"
+	EventDeleteUser    EventType = "delete_user"
+	EventGenerateToken EventType = "generate_token"
+)
+
+// An operation carried out by the SDK, as passed to the listener set with
+// `WithEventListener`.
+type Event struct {
+	Type EventType
+	// When the operation finished.
+	Time time.Time
+	// The method that carried out the operation, such as `PublishToUsers`.
+	// Batched publishes report every chunk as a separate operation.
+	Method string
+	// A summary of the interests or user ids targeted, redacted as in logs.
+	Target string
+	// Why the operation failed, or nil if it succeeded.
+	Err error
+}
+
+// Calls the event listener, if any, with an event for an operation on
+// `target` that finished with `err`.
+func (pn *pushNotifications) emitEvent(eventType EventType, method string, target func() string, err error) {
+	if pn.eventListener == nil {
+		return
+	}
+
+	pn.eventListener(Event{
+		Type:   eventType,
+		Time:   time.Now(),
+		Method: method,
+		Target: target(),
+		Err:    err,
+	})
+}
+
+// Summarises `targets` without giving away more than the start of the first.
+func summariseTargets(kind string, targets []string) string {
+	if len(targets) == 0 {
+		return fmt.Sprintf("0 %s", kind)
+	}
+
+	return fmt.Sprintf("%d %s (%s, ...)", len(targets), kind, redact(printable(targets[0])))
+}
@@ -0,0 +1,73 @@
+package pushnotifications
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEventListener(t *testing.T) {
+	Convey("A Push Notifications Instance with an event listener", t, func() {
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"publishId":"pub-123"}`))
+		}))
+		defer testServer.Close()
+
+		var events []Event
+		pn, err := New(testInstanceId, testSecretKey,
+			WithCustomBaseURL(testServer.URL),
+			WithEventListener(func(event Event) {
+				events = append(events, event)
+			}),
+		)
+		So(err, ShouldBeNil)
+
+		Convey("should emit an event for a token generation", func() {
+			before := time.Now()
+			_, err := pn.GenerateToken("user-123")
+			So(err, ShouldBeNil)
+
+			So(events, ShouldHaveLength, 1)
+			So(events[0].Type, ShouldEqual, EventGenerateToken)
+			So(events[0].Method, ShouldEqual, "GenerateToken")
+			So(events[0].Target, ShouldEqual, "1 users (user***, ...)")
+			So(events[0].Time, ShouldHappenOnOrAfter, before)
+			So(events[0].Err, ShouldBeNil)
+		})
+
+		Convey("should emit an event for a publish", func() {
+			_, err := pn.PublishToInterests([]string{"hello", "world"}, testPublishRequest)
+			So(err, ShouldBeNil)
+
+			So(events, ShouldHaveLength, 1)
+			So(events[0].Type, ShouldEqual, EventPublish)
+			So(events[0].Method, ShouldEqual, "PublishToInterests")
+			So(events[0].Target, ShouldEqual, "2 interests (hell***, ...)")
+			So(events[0].Err, ShouldBeNil)
+		})
+
+		Convey("should emit events for failed operations", func() {
+			_, err := pn.PublishToUsers(nil, testPublishRequest)
+			So(err, ShouldNotBeNil)
+			err = pn.DeleteUser("")
+			So(err, ShouldNotBeNil)
+
+			So(events, ShouldHaveLength, 2)
+			So(events[0].Method, ShouldEqual, "PublishToUsers")
+			So(events[0].Target, ShouldEqual, "0 users")
+			So(errors.Is(events[0].Err, ErrNoUsers), ShouldBeTrue)
+			So(events[1].Type, ShouldEqual, EventDeleteUser)
+			So(errors.Is(events[1].Err, ErrInvalidUserId), ShouldBeTrue)
+		})
+
+		Convey("should not create an instance with a nil listener", func() {
+			pn, err := New(testInstanceId, testSecretKey, WithEventListener(nil))
+			So(pn, ShouldBeNil)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"net/http"
 
 	"github.com/pusher/push-notifications-go"
@@ -15,30 +14,11 @@ const (
 func main2() {
 	beamsClient, _ := pushnotifications.New(instanceId, secretKey)
 
-	http.HandleFunc("/pusher/beams-auth", func(w http.ResponseWriter, r *http.Request) {
+	http.Handle("/pusher/beams-auth", pushnotifications.BeamsAuthHandler(beamsClient, func(r *http.Request) (string, bool) {
 		// Do your normal auth checks here 🔒
 		userID := "" // get it from your auth system
-		userIDinQueryParam := r.URL.Query().Get("user_id")
-		if userID != userIDinQueryParam {
-			w.WriteHeader(http.StatusUnauthorized)
-			return
-		}
-
-		beamsToken, err := beamsClient.GenerateToken(userID)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		beamsTokenJson, err := json.Marshal(beamsToken)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		w.WriteHeader(http.StatusOK)
-		w.Write(beamsTokenJson)
-	})
+		return userID, userID != ""
+	}))
 
 	http.ListenAndServe(":8080", nil)
 }
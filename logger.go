@@ -0,0 +1,92 @@
+package pushnotifications
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// A leveled logger the SDK reports diagnostics to.
+// The secret key is never included in what is logged.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+}
+
+// The default `Logger`, which discards everything.
+type noopLogger struct{}
+
+func (noopLogger) Debugf(format string, args ...interface{}) {}
+func (noopLogger) Warnf(format string, args ...interface{})  {}
+
+// Logs the outcome of an attempt at a request to the Beams API: failures as
+// warnings, anything else at debug level. Headers are never logged, so
+// neither is the Secret Key, and user ids are redacted.
+func (pn *pushNotifications) logAttempt(httpReq *http.Request, httpResp *http.Response, responseBytes []byte, err error) {
+	target := httpReq.Method + " " + loggableURL(httpReq.URL)
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		// Leave out the URL, which has the user id in it.
+		err = urlErr.Err
+	}
+
+	switch {
+	case err != nil && httpResp == nil:
+		pn.logger.Warnf("Request failed: %s: %v", target, err)
+	case err != nil:
+		pn.logger.Warnf("Request failed: %s: %d, reading the response: %v", target, httpResp.StatusCode, err)
+	case httpResp.StatusCode >= http.StatusBadRequest:
+		pn.logger.Warnf("Request failed: %s: %d%s", target, httpResp.StatusCode, pn.loggableBody(responseBytes))
+	default:
+		pn.logger.Debugf("Request succeeded: %s: %d%s%s", target, httpResp.StatusCode, publishDetails(httpReq, responseBytes), pn.loggableBody(responseBytes))
+	}
+}
+
+// The context key of the public method a publish request was made for.
+type publishMethodKey struct{}
+
+// Returns the public method and publish id of a successful publish to append
+// to its log line, e.g. to find the publish in the Beams dashboard. Empty for
+// requests other than publishes.
+func publishDetails(httpReq *http.Request, responseBytes []byte) string {
+	method, ok := httpReq.Context().Value(publishMethodKey{}).(string)
+	if !ok {
+		return ""
+	}
+
+	pubResponse := &publishResponse{}
+	json.Unmarshal(responseBytes, pubResponse)
+	return fmt.Sprintf(": %s, publish id %s", method, pubResponse.PublishId)
+}
+
+// Returns `u` for logs, with the user id of a user deletion redacted.
+func loggableURL(u *url.URL) string {
+	const usersSegment = "/users/"
+	i := strings.LastIndex(u.Path, usersSegment)
+	if !strings.Contains(u.Path, "/customer_api/") || i == -1 {
+		return u.String()
+	}
+
+	redacted := *u
+	redacted.Path = u.Path[:i+len(usersSegment)] + redact(printable(u.Path[i+len(usersSegment):]))
+	// Kept as is where possible, so that the redaction reads as in other logs.
+	redacted.RawPath = redacted.Path
+	return redacted.String()
+}
+
+// Returns the start of `responseBytes` to append to a log line, if response
+// bodies are logged.
+func (pn *pushNotifications) loggableBody(responseBytes []byte) string {
+	if pn.logResponseBodyBytes <= 0 {
+		return ""
+	}
+
+	if len(responseBytes) > pn.logResponseBodyBytes {
+		return ": " + printable(string(responseBytes[:pn.logResponseBodyBytes])) + "..."
+	}
+	return ": " + printable(string(responseBytes))
+}
@@ -0,0 +1,183 @@
+package pushnotifications
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type capturedLog struct {
+	level   string
+	message string
+}
+
+// A `Logger` that keeps everything logged to it, for assertions.
+type captureLogger struct {
+	mu   sync.Mutex
+	logs []capturedLog
+}
+
+func (l *captureLogger) log(level, format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logs = append(l.logs, capturedLog{level: level, message: fmt.Sprintf(format, args...)})
+}
+
+func (l *captureLogger) Debugf(format string, args ...interface{}) { l.log("debug", format, args...) }
+func (l *captureLogger) Warnf(format string, args ...interface{})  { l.log("warn", format, args...) }
+
+func (l *captureLogger) messages(level string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	messages := []string{}
+	for _, entry := range l.logs {
+		if entry.level == level {
+			messages = append(messages, entry.message)
+		}
+	}
+	return messages
+}
+
+func TestLogger(t *testing.T) {
+	Convey("A Push Notifications Instance with a logger", t, func() {
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"publishId":"pub-123"}`))
+		}))
+		defer testServer.Close()
+
+		logger := &captureLogger{}
+
+		Convey("using `WithWarnNumericInterests`, it", func() {
+			pn, err := New(testInstanceId, testSecretKey,
+				WithCustomBaseURL(testServer.URL),
+				WithLogger(logger),
+				WithWarnNumericInterests(),
+			)
+			So(err, ShouldBeNil)
+
+			Convey("should warn when publishing to a purely numeric interest", func() {
+				_, err := pn.PublishToInterests([]string{"123"}, testPublishRequest)
+				So(err, ShouldBeNil)
+				So(logger.messages("warn"), ShouldHaveLength, 1)
+				So(logger.messages("warn")[0], ShouldContainSubstring, "Interest `123` is purely numeric")
+			})
+
+			Convey("should not warn when publishing to an alphanumeric interest", func() {
+				_, err := pn.PublishToInterests([]string{"abc123"}, testPublishRequest)
+				So(err, ShouldBeNil)
+				So(logger.messages("warn"), ShouldBeEmpty)
+			})
+		})
+
+		Convey("should log every request at debug level", func() {
+			pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL), WithLogger(logger))
+			So(err, ShouldBeNil)
+
+			_, err = pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+			So(err, ShouldBeNil)
+			So(pn.DeleteUser("alice@example.com"), ShouldBeNil)
+
+			So(logger.messages("debug"), ShouldResemble, []string{
+				"Request succeeded: POST " + testServer.URL + "/publish_api/v1/instances/i-123/publishes: 200: PublishToInterests, publish id pub-123",
+				"Request succeeded: DELETE " + testServer.URL + "/customer_api/v1/instances/i-123/users/alic***: 200",
+			})
+		})
+
+		Convey("should log the method and publish id of successful publishes", func() {
+			pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL), WithLogger(logger))
+			So(err, ShouldBeNil)
+
+			_, err = pn.PublishToUsers([]string{"u-123"}, testPublishRequest)
+			So(err, ShouldBeNil)
+			_, err = pn.PublishRawToInterests([]string{"hello"}, json.RawMessage(`{"web":{"notification":{"title":"Hi"}}}`))
+			So(err, ShouldBeNil)
+
+			So(logger.messages("debug"), ShouldResemble, []string{
+				"Request succeeded: POST " + testServer.URL + "/publish_api/v1/instances/i-123/publishes/users: 200: PublishToUsers, publish id pub-123",
+				"Request succeeded: POST " + testServer.URL + "/publish_api/v1/instances/i-123/publishes: 200: PublishRawToInterests, publish id pub-123",
+			})
+		})
+
+		Convey("should log failed requests as warnings, without the Secret Key", func() {
+			failingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"Bad Request","description":"the request was not valid"}`))
+			}))
+			defer failingServer.Close()
+			pn, err := New(testInstanceId, testSecretKey,
+				WithCustomBaseURL(failingServer.URL),
+				WithLogger(logger),
+				WithResponseBodyLogging(24),
+			)
+			So(err, ShouldBeNil)
+
+			_, err = pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+			So(err, ShouldNotBeNil)
+
+			So(logger.messages("warn"), ShouldResemble, []string{
+				"Request failed: POST " + failingServer.URL + "/publish_api/v1/instances/i-123/publishes: 400: " +
+					`{"error":"Bad Request","...`,
+			})
+			for _, entry := range logger.logs {
+				So(entry.message, ShouldNotContainSubstring, testSecretKey)
+			}
+		})
+
+		Convey("should log timeouts without the user id", func() {
+			slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(200 * time.Millisecond)
+			}))
+			defer slowServer.Close()
+			pn, err := New(testInstanceId, testSecretKey,
+				WithCustomBaseURL(slowServer.URL),
+				WithLogger(logger),
+				WithRequestTimeout(50*time.Millisecond),
+			)
+			So(err, ShouldBeNil)
+
+			err = pn.DeleteUser("secret-user-id-xyz")
+			var timeoutErr *TimeoutError
+			So(errors.As(err, &timeoutErr), ShouldBeTrue)
+			So(logger.messages("warn"), ShouldHaveLength, 1)
+			So(logger.messages("warn")[0], ShouldContainSubstring, "/users/secr***: ")
+			So(logger.messages("warn")[0], ShouldNotContainSubstring, "secret-user-id-xyz")
+		})
+
+		Convey("should log network errors without the user id", func() {
+			pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL), WithLogger(logger))
+			So(err, ShouldBeNil)
+			testServer.Close()
+
+			So(pn.DeleteUser("alice@example.com"), ShouldNotBeNil)
+			So(logger.messages("warn"), ShouldHaveLength, 1)
+			So(logger.messages("warn")[0], ShouldStartWith, "Request failed: DELETE "+testServer.URL+"/customer_api/v1/instances/i-123/users/alic***: ")
+			So(logger.messages("warn")[0], ShouldNotContainSubstring, "alice@example.com")
+		})
+
+		Convey("should not create an instance with a non-positive body logging limit", func() {
+			pn, err := New(testInstanceId, testSecretKey, WithResponseBodyLogging(0))
+			So(pn, ShouldBeNil)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("should not warn about numeric interests unless asked to", func() {
+			pn, err := New(testInstanceId, testSecretKey,
+				WithCustomBaseURL(testServer.URL),
+				WithLogger(logger),
+			)
+			So(err, ShouldBeNil)
+
+			_, err = pn.PublishToInterests([]string{"123"}, testPublishRequest)
+			So(err, ShouldBeNil)
+			So(logger.messages("warn"), ShouldBeEmpty)
+		})
+	})
+}
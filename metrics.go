@@ -0,0 +1,16 @@
+package pushnotifications
+
+import (
+	"time"
+)
+
+// Receives the latency and outcome of calls to the Beams API, e.g. to record
+// them as Prometheus histograms. Methods are called synchronously once each
+// call finishes, and may be called concurrently.
+type MetricsRecorder interface {
+	// Called after every publish, including those that fail. `statusCode` is
+	// that of the last response, or 0 if none was received.
+	ObservePublish(duration time.Duration, statusCode int, err error)
+	// Like `ObservePublish`, but for user deletions.
+	ObserveDeleteUser(duration time.Duration, statusCode int, err error)
+}
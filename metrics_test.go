@@ -0,0 +1,96 @@
+package pushnotifications
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type observation struct {
+	operation  string
+	duration   time.Duration
+	statusCode int
+	err        error
+}
+
+// A `MetricsRecorder` that keeps every observation, for assertions.
+type recordingMetrics struct {
+	mu           sync.Mutex
+	observations []observation
+}
+
+func (m *recordingMetrics) observe(operation string, duration time.Duration, statusCode int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observations = append(m.observations, observation{operation, duration, statusCode, err})
+}
+
+func (m *recordingMetrics) ObservePublish(duration time.Duration, statusCode int, err error) {
+	m.observe("publish", duration, statusCode, err)
+}
+
+func (m *recordingMetrics) ObserveDeleteUser(duration time.Duration, statusCode int, err error) {
+	m.observe("delete_user", duration, statusCode, err)
+}
+
+func TestMetrics(t *testing.T) {
+	Convey("A Push Notifications Instance with a metrics recorder", t, func() {
+		statusCode := http.StatusOK
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(10 * time.Millisecond)
+			w.WriteHeader(statusCode)
+			if statusCode == http.StatusOK {
+				w.Write([]byte(`{"publishId":"pub-123"}`))
+			} else {
+				w.Write([]byte(`{"error":"Bad Request","description":"nope"}`))
+			}
+		}))
+		defer testServer.Close()
+
+		metrics := &recordingMetrics{}
+		pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL), WithMetrics(metrics))
+		So(err, ShouldBeNil)
+
+		Convey("should observe a successful publish", func() {
+			_, err := pn.PublishToUsers([]string{"u-123"}, testPublishRequest)
+			So(err, ShouldBeNil)
+
+			So(metrics.observations, ShouldHaveLength, 1)
+			So(metrics.observations[0].operation, ShouldEqual, "publish")
+			So(metrics.observations[0].duration, ShouldBeGreaterThanOrEqualTo, 10*time.Millisecond)
+			So(metrics.observations[0].statusCode, ShouldEqual, http.StatusOK)
+			So(metrics.observations[0].err, ShouldBeNil)
+		})
+
+		Convey("should observe a failed user deletion", func() {
+			statusCode = http.StatusBadRequest
+			err := pn.DeleteUser("u-123")
+			So(err, ShouldNotBeNil)
+
+			So(metrics.observations, ShouldHaveLength, 1)
+			So(metrics.observations[0].operation, ShouldEqual, "delete_user")
+			So(metrics.observations[0].statusCode, ShouldEqual, http.StatusBadRequest)
+			So(metrics.observations[0].err, ShouldEqual, err)
+		})
+
+		Convey("should observe a publish that got no response", func() {
+			testServer.Close()
+			_, err := pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+			So(err, ShouldNotBeNil)
+
+			So(metrics.observations, ShouldHaveLength, 1)
+			So(metrics.observations[0].statusCode, ShouldEqual, 0)
+			So(metrics.observations[0].err, ShouldEqual, err)
+		})
+
+		Convey("should not create an instance with a nil metrics recorder", func() {
+			pn, err := New(testInstanceId, testSecretKey, WithMetrics(nil))
+			So(pn, ShouldBeNil)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,854 @@
+package pushnotifications
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type requestIdContextKey struct{}
+
+func TestOptions(t *testing.T) {
+	Convey("A Push Notifications Instance with options", t, func() {
+		var lastRequest *http.Request
+		var lastRequestBody []byte
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lastRequest = r
+			lastRequestBody, _ = ioutil.ReadAll(r.Body)
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"publishId":"pub-123"}`))
+		}))
+		defer testServer.Close()
+
+		Convey("using `WithContextRequestIDKey`, it", func() {
+			pn, err := New(testInstanceId, testSecretKey,
+				WithCustomBaseURL(testServer.URL),
+				WithContextRequestIDKey(requestIdContextKey{}, "X-Request-Id"),
+			)
+			So(err, ShouldBeNil)
+
+			Convey("should send the request id found in the context as a header", func() {
+				ctx := context.WithValue(context.Background(), requestIdContextKey{}, "req-123")
+				_, err := pn.(*pushNotifications).publishToInterests(ctx, []string{"hello"}, testPublishRequest)
+				So(err, ShouldBeNil)
+				So(lastRequest.Header.Get("X-Request-Id"), ShouldEqual, "req-123")
+			})
+
+			Convey("should not send the header if the context has no request id", func() {
+				_, err := pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+				So(err, ShouldBeNil)
+				So(lastRequest.Header, ShouldNotContainKey, "X-Request-Id")
+			})
+
+			Convey("should not create an instance with an empty header name", func() {
+				noPN, err := New(testInstanceId, testSecretKey, WithContextRequestIDKey(requestIdContextKey{}, " "))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "Request id header name cannot be an empty string")
+				So(noPN, ShouldBeNil)
+			})
+
+			Convey("should not create an instance with a header set by the SDK", func() {
+				for _, headerName := range []string{"Authorization", "content-type", "X-Pusher-Library"} {
+					noPN, err := New(testInstanceId, testSecretKey, WithContextRequestIDKey(requestIdContextKey{}, headerName))
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, "is set by the SDK and cannot be overridden")
+					So(noPN, ShouldBeNil)
+				}
+			})
+		})
+
+		Convey("using `WithAuthScheme`, it", func() {
+			Convey("should not create an instance with an empty scheme", func() {
+				noPN, err := New(testInstanceId, testSecretKey, WithAuthScheme(""))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "Authorization scheme cannot be an empty string")
+				So(noPN, ShouldBeNil)
+			})
+
+			pn, err := New(testInstanceId, testSecretKey,
+				WithCustomBaseURL(testServer.URL),
+				WithAuthScheme("Token"),
+			)
+			So(err, ShouldBeNil)
+
+			Convey("should use the custom scheme when publishing", func() {
+				_, err := pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+				So(err, ShouldBeNil)
+				So(lastRequest.Header.Get("Authorization"), ShouldEqual, "Token "+testSecretKey)
+			})
+
+			Convey("should use the custom scheme when deleting a user", func() {
+				err := pn.DeleteUser("u-123")
+				So(err, ShouldBeNil)
+				So(lastRequest.Header.Get("Authorization"), ShouldEqual, "Token "+testSecretKey)
+			})
+		})
+
+		Convey("should use the `Bearer` scheme by default", func() {
+			pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL))
+			So(err, ShouldBeNil)
+
+			_, err = pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+			So(err, ShouldBeNil)
+			So(lastRequest.Header.Get("Authorization"), ShouldEqual, "Bearer "+testSecretKey)
+		})
+
+		Convey("using `WithMaxConcurrency`, it", func() {
+			Convey("should not create an instance with a non-positive limit", func() {
+				noPN, err := New(testInstanceId, testSecretKey, WithMaxConcurrency(0))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "Max concurrency must be positive")
+				So(noPN, ShouldBeNil)
+			})
+
+			Convey("should never have more requests in flight than the limit", func() {
+				var inFlight, maxInFlight int32
+				slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					current := atomic.AddInt32(&inFlight, 1)
+					defer atomic.AddInt32(&inFlight, -1)
+					for {
+						max := atomic.LoadInt32(&maxInFlight)
+						if current <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, current) {
+							break
+						}
+					}
+					time.Sleep(50 * time.Millisecond)
+					w.Write([]byte(`{"publishId":"pub-123"}`))
+				}))
+				defer slowServer.Close()
+
+				pn, err := New(testInstanceId, testSecretKey,
+					WithCustomBaseURL(slowServer.URL),
+					WithMaxConcurrency(2),
+				)
+				So(err, ShouldBeNil)
+
+				var wg sync.WaitGroup
+				errs := make(chan error, 10)
+				for i := 0; i < 10; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						request := map[string]interface{}{"fcm": testPublishRequest["fcm"]}
+						_, err := pn.PublishToInterests([]string{"hello"}, request)
+						errs <- err
+					}()
+				}
+				wg.Wait()
+				close(errs)
+
+				for err := range errs {
+					So(err, ShouldBeNil)
+				}
+				So(atomic.LoadInt32(&maxInFlight), ShouldEqual, 2)
+			})
+		})
+
+		Convey("using `WithStrictValidation`, it", func() {
+			instanceId := "9aa32e04-a212-44ab-a592-9aeba66e46ac"
+			secretKey := "188C879D394E09FDECC04606A126FAE2125FEABD24A2D12C6AC969AE1CEE2AEC"
+
+			Convey("should hint that the arguments may be swapped", func() {
+				noPN, err := New(secretKey, instanceId, WithStrictValidation())
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "the arguments may be swapped")
+				So(noPN, ShouldBeNil)
+			})
+
+			Convey("should accept arguments in the right order", func() {
+				pn, err := New(instanceId, secretKey, WithStrictValidation())
+				So(err, ShouldBeNil)
+				So(pn, ShouldNotBeNil)
+			})
+		})
+
+		Convey("should not check for swapped arguments by default", func() {
+			pn, err := New(
+				"188C879D394E09FDECC04606A126FAE2125FEABD24A2D12C6AC969AE1CEE2AEC",
+				"9aa32e04-a212-44ab-a592-9aeba66e46ac",
+			)
+			So(err, ShouldBeNil)
+			So(pn, ShouldNotBeNil)
+		})
+
+		Convey("using `WithInterestPrefix`, it", func() {
+			Convey("should not create an instance with an empty prefix", func() {
+				noPN, err := New(testInstanceId, testSecretKey, WithInterestPrefix(""))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "Interest prefix cannot be an empty string")
+				So(noPN, ShouldBeNil)
+			})
+
+			pn, err := New(testInstanceId, testSecretKey,
+				WithCustomBaseURL(testServer.URL),
+				WithInterestPrefix("app."),
+			)
+			So(err, ShouldBeNil)
+
+			Convey("should reject an interest without the prefix", func() {
+				pubId, err := pn.PublishToInterests([]string{"app.news", "news"}, testPublishRequest)
+				So(pubId, ShouldEqual, "")
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "Interest `news` does not start with the required prefix `app.`")
+			})
+
+			Convey("should accept interests with the prefix", func() {
+				pubId, err := pn.PublishToInterests([]string{"app.news", "app.sports"}, testPublishRequest)
+				So(err, ShouldBeNil)
+				So(pubId, ShouldEqual, "pub-123")
+			})
+		})
+
+		Convey("using `WithClientTrace`, it", func() {
+			var gotConns int32
+			pn, err := New(testInstanceId, testSecretKey,
+				WithCustomBaseURL(testServer.URL),
+				WithClientTrace(func(ctx context.Context) *httptrace.ClientTrace {
+					return &httptrace.ClientTrace{
+						GotConn: func(httptrace.GotConnInfo) {
+							atomic.AddInt32(&gotConns, 1)
+						},
+					}
+				}),
+			)
+			So(err, ShouldBeNil)
+
+			Convey("should call the trace hooks when publishing", func() {
+				_, err := pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+				So(err, ShouldBeNil)
+				So(atomic.LoadInt32(&gotConns), ShouldEqual, 1)
+			})
+
+			Convey("should call the trace hooks when deleting a user", func() {
+				err := pn.DeleteUser("u-123")
+				So(err, ShouldBeNil)
+				So(atomic.LoadInt32(&gotConns), ShouldEqual, 1)
+			})
+		})
+
+		Convey("using `WithPayloadEnvelopeKey`, it", func() {
+			Convey("should not create an instance with an empty key", func() {
+				noPN, err := New(testInstanceId, testSecretKey, WithPayloadEnvelopeKey(""))
+				So(err, ShouldNotBeNil)
+				So(noPN, ShouldBeNil)
+			})
+
+			pn, err := New(testInstanceId, testSecretKey,
+				WithCustomBaseURL(testServer.URL),
+				WithPayloadEnvelopeKey("message"),
+			)
+			So(err, ShouldBeNil)
+
+			Convey("should nest the platform payloads under the key when publishing to interests", func() {
+				request := map[string]interface{}{"fcm": testPublishRequest["fcm"]}
+				_, err := pn.PublishToInterests([]string{"hello"}, request)
+				So(err, ShouldBeNil)
+
+				expected := `{"interests":["hello"],"message":{"fcm":{"notification":{"body":"Hello, world","title":"Hello"}}}}`
+				So(string(lastRequestBody), ShouldEqual, expected)
+			})
+
+			Convey("should nest the platform payloads under the key when publishing to users", func() {
+				request := map[string]interface{}{"fcm": testPublishRequest["fcm"]}
+				_, err := pn.PublishToUsers([]string{"u-123"}, request)
+				So(err, ShouldBeNil)
+
+				expected := `{"message":{"fcm":{"notification":{"body":"Hello, world","title":"Hello"}}},"users":["u-123"]}`
+				So(string(lastRequestBody), ShouldEqual, expected)
+			})
+		})
+
+		Convey("using `WithHTTPClient`, it", func() {
+			Convey("should not create an instance with a nil client", func() {
+				pn, err := New(testInstanceId, testSecretKey, WithHTTPClient(nil))
+				So(pn, ShouldBeNil)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "HTTP client cannot be nil")
+			})
+
+			Convey("should send requests with the custom client", func() {
+				var roundTrips int32
+				httpClient := &http.Client{
+					Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+						atomic.AddInt32(&roundTrips, 1)
+						return http.DefaultTransport.RoundTrip(r)
+					}),
+				}
+				pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL), WithHTTPClient(httpClient))
+				So(err, ShouldBeNil)
+
+				_, err = pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+				So(err, ShouldBeNil)
+				So(atomic.LoadInt32(&roundTrips), ShouldEqual, 1)
+			})
+
+			Convey("should let a later `WithRequestTimeout` set the timeout without changing the given client", func() {
+				httpClient := &http.Client{Timeout: time.Minute}
+				pn, err := New(testInstanceId, testSecretKey, WithHTTPClient(httpClient), WithRequestTimeout(time.Second))
+				So(err, ShouldBeNil)
+				So(pn.(*pushNotifications).httpClient.Timeout, ShouldEqual, time.Second)
+				So(httpClient.Timeout, ShouldEqual, time.Minute)
+			})
+		})
+
+		Convey("using `WithTransport`, it", func() {
+			Convey("should not create an instance with a nil transport", func() {
+				pn, err := New(testInstanceId, testSecretKey, WithTransport(nil))
+				So(pn, ShouldBeNil)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "Transport cannot be nil")
+			})
+
+			Convey("should send publishes through the transport", func() {
+				var tracedRequest *http.Request
+				transport := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+					tracedRequest = r
+					r.Header.Set("X-Trace-Id", "trace-1")
+					return http.DefaultTransport.RoundTrip(r)
+				})
+				pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL), WithTransport(transport))
+				So(err, ShouldBeNil)
+
+				_, err = pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+				So(err, ShouldBeNil)
+				So(tracedRequest, ShouldNotBeNil)
+				So(tracedRequest.Method, ShouldEqual, http.MethodPost)
+				So(lastRequest.Header.Get("X-Trace-Id"), ShouldEqual, "trace-1")
+			})
+
+			Convey("should compose with `WithRequestTimeout` in either order", func() {
+				transport := roundTripperFunc(http.DefaultTransport.RoundTrip)
+				for _, options := range [][]Option{
+					{WithTransport(transport), WithRequestTimeout(time.Second)},
+					{WithRequestTimeout(time.Second), WithTransport(transport)},
+				} {
+					pn, err := New(testInstanceId, testSecretKey, options...)
+					So(err, ShouldBeNil)
+					So(pn.(*pushNotifications).httpClient.Timeout, ShouldEqual, time.Second)
+					So(pn.(*pushNotifications).httpClient.Transport, ShouldNotBeNil)
+				}
+			})
+		})
+
+		Convey("using `WithDeprecatedMethodsDisabled`, it", func() {
+			pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL), WithDeprecatedMethodsDisabled())
+			So(err, ShouldBeNil)
+
+			Convey("should fail to `Publish` without sending a request", func() {
+				publishId, err := pn.Publish([]string{"hello"}, testPublishRequest)
+				So(publishId, ShouldEqual, "")
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "use PublishToInterests instead")
+				So(lastRequest, ShouldBeNil)
+			})
+
+			Convey("should fail to `PublishToInterestsRawPayload` without sending a request", func() {
+				publishId, err := pn.PublishToInterestsRawPayload([]string{"hello"}, json.RawMessage(`{"fcm":{}}`))
+				So(publishId, ShouldEqual, "")
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "use PublishRawToInterests instead")
+				So(lastRequest, ShouldBeNil)
+			})
+
+			Convey("should still allow `PublishToInterests`", func() {
+				_, err := pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("should allow `Publish` by default", func() {
+			pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL))
+			So(err, ShouldBeNil)
+
+			_, err = pn.Publish([]string{"hello"}, testPublishRequest)
+			So(err, ShouldBeNil)
+			So(lastRequest.URL.Path, ShouldEqual, "/publish_api/v1/instances/i-123/publishes")
+		})
+
+		Convey("using `WithFallbackSecretKey`, it", func() {
+			Convey("should not create an instance with an invalid fallback key", func() {
+				for _, secretKey := range []string{"", "k-\n789"} {
+					pn, err := New(testInstanceId, testSecretKey, WithFallbackSecretKey(secretKey))
+					So(pn, ShouldBeNil)
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, "Fallback Secret Key")
+				}
+			})
+
+			Convey("should retry a publish rejected with 401 with the fallback key", func() {
+				var authorizations []string
+				rotatedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					authorizations = append(authorizations, r.Header.Get("Authorization"))
+					if r.Header.Get("Authorization") != "Bearer k-789" {
+						w.WriteHeader(http.StatusUnauthorized)
+						w.Write([]byte(`{"error":"Unauthorized","description":"Incorrect Secret Key"}`))
+						return
+					}
+					w.Write([]byte(`{"publishId":"pub-123"}`))
+				}))
+				defer rotatedServer.Close()
+
+				pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(rotatedServer.URL), WithFallbackSecretKey("k-789"))
+				So(err, ShouldBeNil)
+
+				publishId, err := pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+				So(err, ShouldBeNil)
+				So(publishId, ShouldEqual, "pub-123")
+				So(authorizations, ShouldResemble, []string{"Bearer k-456", "Bearer k-789"})
+			})
+
+			Convey("should only use the fallback key after a 401", func() {
+				pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL), WithFallbackSecretKey("k-789"))
+				So(err, ShouldBeNil)
+
+				_, err = pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+				So(err, ShouldBeNil)
+				So(lastRequest.Header.Get("Authorization"), ShouldEqual, "Bearer k-456")
+			})
+		})
+
+		Convey("using `WithResponseInspector`, it", func() {
+			Convey("should not create an instance with a nil inspector", func() {
+				pn, err := New(testInstanceId, testSecretKey, WithResponseInspector(nil))
+				So(pn, ShouldBeNil)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "Response inspector cannot be nil")
+			})
+
+			Convey("should call the inspector with every response before the body is read", func() {
+				var inspected []*http.Response
+				pn, err := New(testInstanceId, testSecretKey,
+					WithCustomBaseURL(testServer.URL),
+					WithResponseInspector(func(r *http.Response) {
+						inspected = append(inspected, r)
+					}),
+				)
+				So(err, ShouldBeNil)
+
+				_, err = pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+				So(err, ShouldBeNil)
+				So(pn.DeleteUser("u-123"), ShouldBeNil)
+
+				So(inspected, ShouldHaveLength, 2)
+				So(inspected[0].StatusCode, ShouldEqual, http.StatusOK)
+				So(inspected[0].Request.Method, ShouldEqual, http.MethodPost)
+				So(inspected[1].Request.Method, ShouldEqual, http.MethodDelete)
+			})
+		})
+
+		Convey("using `WithMinTLSVersion`, it", func() {
+			tls11Server := httptest.NewUnstartedServer(testServer.Config.Handler)
+			tls11Server.TLS = &tls.Config{MinVersion: tls.VersionTLS10, MaxVersion: tls.VersionTLS11}
+			tls11Server.StartTLS()
+			defer tls11Server.Close()
+
+			Convey("should not create an instance with an unknown TLS version", func() {
+				pn, err := New(testInstanceId, testSecretKey, WithMinTLSVersion(0x0200))
+				So(pn, ShouldBeNil)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "Unknown TLS version")
+			})
+
+			Convey("should fail the handshake with a server older than the minimum version", func() {
+				pn, err := New(testInstanceId, testSecretKey,
+					WithCustomBaseURL(tls11Server.URL),
+					WithHTTPClient(tls11Server.Client()),
+					WithMinTLSVersion(tls.VersionTLS13),
+				)
+				So(err, ShouldBeNil)
+
+				_, err = pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "network error")
+				So(lastRequest, ShouldBeNil)
+			})
+
+			Convey("should require TLS 1.2 by default", func() {
+				pn, err := New(testInstanceId, testSecretKey,
+					WithCustomBaseURL(tls11Server.URL),
+					WithHTTPClient(tls11Server.Client()),
+				)
+				So(err, ShouldBeNil)
+				transport := pn.(*pushNotifications).httpClient.Transport.(*http.Transport)
+				So(transport.TLSClientConfig.MinVersion, ShouldEqual, tls.VersionTLS12)
+				So(tls11Server.Client().Transport.(*http.Transport).TLSClientConfig.MinVersion, ShouldEqual, 0)
+
+				_, err = pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+				So(err, ShouldNotBeNil)
+				So(lastRequest, ShouldBeNil)
+			})
+
+			Convey("should allow an older server if the minimum version is lowered", func() {
+				pn, err := New(testInstanceId, testSecretKey,
+					WithCustomBaseURL(tls11Server.URL),
+					WithHTTPClient(tls11Server.Client()),
+					WithMinTLSVersion(tls.VersionTLS10),
+				)
+				So(err, ShouldBeNil)
+
+				_, err = pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+				So(err, ShouldBeNil)
+				So(lastRequest, ShouldNotBeNil)
+			})
+
+			Convey("should leave a transport with a stricter policy as it is", func() {
+				transport := &http.Transport{TLSClientConfig: &tls.Config{MinVersion: tls.VersionTLS13}}
+				pn, err := New(testInstanceId, testSecretKey, WithTransport(transport))
+				So(err, ShouldBeNil)
+				So(pn.(*pushNotifications).httpClient.Transport == transport, ShouldBeTrue)
+			})
+
+			Convey("should share one transport between instances using the defaults", func() {
+				pn, err := New(testInstanceId, testSecretKey)
+				So(err, ShouldBeNil)
+				other, err := New(testInstanceId, testSecretKey)
+				So(err, ShouldBeNil)
+				transport := pn.(*pushNotifications).httpClient.Transport.(*http.Transport)
+				So(transport == other.(*pushNotifications).httpClient.Transport, ShouldBeTrue)
+				So(transport == http.DefaultTransport, ShouldBeFalse)
+				So(transport.TLSClientConfig.MinVersion, ShouldEqual, tls.VersionTLS12)
+
+				pn, err = New(testInstanceId, testSecretKey, WithMinTLSVersion(tls.VersionTLS13))
+				So(err, ShouldBeNil)
+				transport = pn.(*pushNotifications).httpClient.Transport.(*http.Transport)
+				So(transport == sharedDefaultTLSTransport(), ShouldBeFalse)
+				So(transport.TLSClientConfig.MinVersion, ShouldEqual, tls.VersionTLS13)
+			})
+		})
+
+		Convey("using `WithInterestPrefixAutoApply`, it", func() {
+			pn, err := New(testInstanceId, testSecretKey,
+				WithCustomBaseURL(testServer.URL),
+				WithInterestPrefixAutoApply("tenant-42-"),
+				WithInterestPrefix("tenant-42-"),
+			)
+			So(err, ShouldBeNil)
+
+			Convey("should prefix every interest published to", func() {
+				interests := []string{"news", "sports"}
+				_, err := pn.PublishToInterests(interests, testPublishRequest)
+				So(err, ShouldBeNil)
+				So(string(lastRequestBody), ShouldContainSubstring, `"interests":["tenant-42-news","tenant-42-sports"]`)
+				So(interests, ShouldResemble, []string{"news", "sports"})
+			})
+
+			Convey("should not create an instance with an invalid prefix", func() {
+				for _, prefix := range []string{"", "tenant 42"} {
+					noPN, err := New(testInstanceId, testSecretKey, WithInterestPrefixAutoApply(prefix))
+					So(err, ShouldNotBeNil)
+					So(noPN, ShouldBeNil)
+				}
+			})
+		})
+
+		Convey("using `WithLibrarySuffix`, it", func() {
+			Convey("should append the suffix to the library header", func() {
+				pn, err := New(testInstanceId, testSecretKey,
+					WithCustomBaseURL(testServer.URL),
+					WithLibrarySuffix(" billing-service;\r\nX-Injected: 1 "),
+				)
+				So(err, ShouldBeNil)
+
+				So(pn.DeleteUser("u-123"), ShouldBeNil)
+				So(lastRequest.Header.Get("X-Pusher-Library"), ShouldEqual,
+					"pusher-push-notifications-go "+sdkVersion+"; billing-serviceX-Injected: 1")
+			})
+
+			Convey("should not create an instance with a suffix with nothing printable", func() {
+				noPN, err := New(testInstanceId, testSecretKey, WithLibrarySuffix(" \n"))
+				So(err, ShouldNotBeNil)
+				So(noPN, ShouldBeNil)
+			})
+		})
+
+		Convey("using `WithHeaders`, it", func() {
+			Convey("should add the headers to every request", func() {
+				headers := http.Header{"X-Proxy-Auth": {"secret"}}
+				pn, err := New(testInstanceId, testSecretKey,
+					WithCustomBaseURL(testServer.URL),
+					WithHeaders(headers),
+					WithHeaders(http.Header{"x-proxy-route": {"beams"}}),
+				)
+				So(err, ShouldBeNil)
+				headers.Set("X-Proxy-Auth", "changed")
+
+				_, err = pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+				So(err, ShouldBeNil)
+				So(lastRequest.Header.Get("X-Proxy-Auth"), ShouldEqual, "secret")
+				So(lastRequest.Header.Get("X-Proxy-Route"), ShouldEqual, "beams")
+
+				So(pn.DeleteUser("u-123"), ShouldBeNil)
+				So(lastRequest.Header.Get("X-Proxy-Auth"), ShouldEqual, "secret")
+			})
+
+			Convey("should not create an instance that overrides the SDK's headers", func() {
+				for _, key := range []string{"Authorization", "content-type", "X-Pusher-Library"} {
+					noPN, err := New(testInstanceId, testSecretKey, WithHeaders(http.Header{key: {"x"}}))
+					So(err, ShouldNotBeNil)
+					So(noPN, ShouldBeNil)
+				}
+			})
+		})
+
+		Convey("using `WithProxy`, it", func() {
+			Convey("should send requests through the proxy", func() {
+				var proxiedURL string
+				proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					proxiedURL = r.URL.String()
+					w.Write([]byte(`{"publishId":"pub-proxied"}`))
+				}))
+				defer proxyServer.Close()
+
+				pn, err := New(testInstanceId, testSecretKey,
+					WithCustomBaseURL("http://beams.invalid"),
+					WithProxy(proxyServer.URL),
+				)
+				So(err, ShouldBeNil)
+
+				publishId, err := pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+				So(err, ShouldBeNil)
+				So(publishId, ShouldEqual, "pub-proxied")
+				So(proxiedURL, ShouldEqual, "http://beams.invalid/publish_api/v1/instances/i-123/publishes")
+			})
+
+			Convey("should not create an instance with an invalid proxy URL", func() {
+				for _, proxyURL := range []string{"://proxy", "ftp://proxy:21", "proxy.internal:3128"} {
+					noPN, err := New(testInstanceId, testSecretKey, WithProxy(proxyURL))
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, "Invalid proxy URL")
+					So(noPN, ShouldBeNil)
+				}
+			})
+
+			Convey("should not create an instance with a transport it can't configure", func() {
+				noPN, err := New(testInstanceId, testSecretKey,
+					WithTransport(roundTripperFunc(http.DefaultTransport.RoundTrip)),
+					WithProxy("http://proxy.internal:3128"),
+				)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "Proxy cannot be used")
+				So(noPN, ShouldBeNil)
+			})
+
+			Convey("should configure a single copy of the transport with the TLS options", func() {
+				transport := &http.Transport{TLSClientConfig: &tls.Config{}}
+				pn, err := New(testInstanceId, testSecretKey,
+					WithTransport(transport),
+					WithProxy("http://proxy.internal:3128"),
+					WithTLSConfig(&tls.Config{ServerName: "beams.invalid"}),
+					WithMinTLSVersion(tls.VersionTLS13),
+				)
+				So(err, ShouldBeNil)
+				So(transport.Proxy, ShouldBeNil)
+				So(transport.TLSClientConfig.ServerName, ShouldBeEmpty)
+				So(transport.TLSClientConfig.MinVersion, ShouldEqual, 0)
+
+				configured := pn.(*pushNotifications).httpClient.Transport.(*http.Transport)
+				So(configured == pn.(*pushNotifications).ownTransport, ShouldBeTrue)
+				So(configured.Proxy, ShouldNotBeNil)
+				So(configured.TLSClientConfig.ServerName, ShouldEqual, "beams.invalid")
+				So(configured.TLSClientConfig.MinVersion, ShouldEqual, tls.VersionTLS13)
+			})
+		})
+
+		Convey("using `WithTLSConfig`, it", func() {
+			tlsServer := httptest.NewTLSServer(testServer.Config.Handler)
+			defer tlsServer.Close()
+
+			Convey("should connect with the TLS config", func() {
+				rootCAs := x509.NewCertPool()
+				rootCAs.AddCert(tlsServer.Certificate())
+				config := &tls.Config{RootCAs: rootCAs}
+				pn, err := New(testInstanceId, testSecretKey,
+					WithCustomBaseURL(tlsServer.URL),
+					WithTLSConfig(config),
+				)
+				So(err, ShouldBeNil)
+				So(config.MinVersion, ShouldEqual, 0)
+
+				_, err = pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+				So(err, ShouldBeNil)
+				So(lastRequest, ShouldNotBeNil)
+			})
+
+			Convey("should not trust the server without the TLS config", func() {
+				pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(tlsServer.URL))
+				So(err, ShouldBeNil)
+
+				_, err = pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+				So(err, ShouldNotBeNil)
+				So(lastRequest, ShouldBeNil)
+			})
+
+			Convey("should not create an instance with a nil TLS config", func() {
+				noPN, err := New(testInstanceId, testSecretKey, WithTLSConfig(nil))
+				So(err, ShouldNotBeNil)
+				So(noPN, ShouldBeNil)
+			})
+		})
+
+		Convey("using `WithRejectPunctuationOnlyInterests`, it", func() {
+			pn, err := New(testInstanceId, testSecretKey,
+				WithCustomBaseURL(testServer.URL),
+				WithRejectPunctuationOnlyInterests(),
+			)
+			So(err, ShouldBeNil)
+
+			Convey("should reject an interest without letters or numbers", func() {
+				for _, interest := range []string{"...", "-_=@,.;"} {
+					_, err := pn.PublishToInterests([]string{"hello", interest}, testPublishRequest)
+					So(errors.Is(err, ErrInvalidInterestName), ShouldBeTrue)
+					So(err.Error(), ShouldContainSubstring, "has no letters or numbers")
+				}
+				So(lastRequest, ShouldBeNil)
+			})
+
+			Convey("should accept interests with letters or numbers", func() {
+				_, err := pn.PublishToInterests([]string{"a.b", "-1-"}, testPublishRequest)
+				So(err, ShouldBeNil)
+			})
+
+			Convey("should accept punctuation-only interests unless asked not to", func() {
+				pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL))
+				So(err, ShouldBeNil)
+				_, err = pn.PublishToInterests([]string{"..."}, testPublishRequest)
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("using `WithMaxInterests` and `WithMaxUsersPerPublish`, it", func() {
+			pn, err := New(testInstanceId, testSecretKey,
+				WithCustomBaseURL(testServer.URL),
+				WithMaxInterests(150),
+				WithMaxUsersPerPublish(1500),
+			)
+			So(err, ShouldBeNil)
+
+			interests := make([]string, 150)
+			for i := range interests {
+				interests[i] = fmt.Sprintf("interest-%d", i)
+			}
+			users := make([]string, 1500)
+			for i := range users {
+				users[i] = fmt.Sprintf("user-%d", i)
+			}
+
+			Convey("should publish up to the raised limits", func() {
+				_, err := pn.PublishToInterests(interests, testPublishRequest)
+				So(err, ShouldBeNil)
+				_, err = pn.PublishToUsers(users, testPublishRequest)
+				So(err, ShouldBeNil)
+			})
+
+			Convey("should reject more than the raised limits", func() {
+				_, err := pn.PublishToInterests(append(interests, "one-more"), testPublishRequest)
+				So(errors.Is(err, ErrTooManyInterests), ShouldBeTrue)
+				So(err.Error(), ShouldContainSubstring, "API only supports up to 150")
+				_, err = pn.PublishToUsers(append(users, "one-more"), testPublishRequest)
+				So(errors.Is(err, ErrTooManyUsers), ShouldBeTrue)
+				So(err.Error(), ShouldContainSubstring, "API supports up to 1500")
+			})
+
+			Convey("should keep the default limits unless asked not to", func() {
+				pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL))
+				So(err, ShouldBeNil)
+				_, err = pn.PublishToInterests(interests, testPublishRequest)
+				So(errors.Is(err, ErrTooManyInterests), ShouldBeTrue)
+				_, err = pn.PublishToUsers(users, testPublishRequest)
+				So(errors.Is(err, ErrTooManyUsers), ShouldBeTrue)
+			})
+
+			Convey("should not create an instance with a non-positive limit", func() {
+				_, err := New(testInstanceId, testSecretKey, WithMaxInterests(0))
+				So(err, ShouldNotBeNil)
+				_, err = New(testInstanceId, testSecretKey, WithMaxUsersPerPublish(-1))
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("using `WithMaxInterestLength`, it", func() {
+			pn, err := New(testInstanceId, testSecretKey,
+				WithCustomBaseURL(testServer.URL),
+				WithMaxInterestLength(200),
+			)
+			So(err, ShouldBeNil)
+
+			Convey("should accept interests up to the custom limit", func() {
+				_, err := pn.PublishToInterests([]string{strings.Repeat("a", 200)}, testPublishRequest)
+				So(err, ShouldBeNil)
+			})
+
+			Convey("should reject interests over the custom limit", func() {
+				_, err := pn.PublishToInterests([]string{strings.Repeat("a", 201)}, testPublishRequest)
+				So(errors.Is(err, ErrInvalidInterestName), ShouldBeTrue)
+				So(err.Error(), ShouldContainSubstring, "Interest length is 201 which is over 200 characters")
+			})
+
+			Convey("should limit interests to 164 characters unless asked not to", func() {
+				pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL))
+				So(err, ShouldBeNil)
+
+				_, err = pn.PublishToInterests([]string{strings.Repeat("a", 164)}, testPublishRequest)
+				So(err, ShouldBeNil)
+				_, err = pn.PublishToInterests([]string{strings.Repeat("a", 165)}, testPublishRequest)
+				So(err.Error(), ShouldContainSubstring, "Interest length is 165 which is over 164 characters")
+			})
+
+			Convey("should not create an instance with a non-positive limit", func() {
+				_, err := New(testInstanceId, testSecretKey, WithMaxInterestLength(0))
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("using `WithSortInterests`, it", func() {
+			pn, err := New(testInstanceId, testSecretKey,
+				WithCustomBaseURL(testServer.URL),
+				WithSortInterests(),
+			)
+			So(err, ShouldBeNil)
+
+			Convey("should send the interests sorted and without duplicates", func() {
+				interests := []string{"zebra", "apple", "mango", "apple"}
+				_, err := pn.PublishToInterests(interests, testPublishRequest)
+				So(err, ShouldBeNil)
+				So(interests, ShouldResemble, []string{"zebra", "apple", "mango", "apple"})
+
+				body := struct {
+					Interests []string `json:"interests"`
+				}{}
+				So(json.Unmarshal(lastRequestBody, &body), ShouldBeNil)
+				So(body.Interests, ShouldResemble, []string{"apple", "mango", "zebra"})
+			})
+
+			Convey("should send the same body for the same interests in any order", func() {
+				_, err := pn.PublishToInterests([]string{"b", "a"}, testPublishRequest)
+				So(err, ShouldBeNil)
+				first := lastRequestBody
+
+				_, err = pn.PublishToInterests([]string{"a", "b", "a"}, testPublishRequest)
+				So(err, ShouldBeNil)
+				So(string(lastRequestBody), ShouldEqual, string(first))
+			})
+		})
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
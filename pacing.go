@@ -0,0 +1,44 @@
+package pushnotifications
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Spaces out publishes so that no more than a given number are sent per second.
+type pacer struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newPacer(perSecond int) *pacer {
+	return &pacer{interval: time.Second / time.Duration(perSecond)}
+}
+
+// Waits for the next free slot, or until `ctx` is done.
+func (p *pacer) wait(ctx context.Context) error {
+	p.mu.Lock()
+	now := time.Now()
+	sendAt := p.next
+	if sendAt.Before(now) {
+		sendAt = now
+	}
+	p.next = sendAt.Add(p.interval)
+	p.mu.Unlock()
+
+	delay := sendAt.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
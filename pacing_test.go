@@ -0,0 +1,46 @@
+package pushnotifications
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDeliveryRate(t *testing.T) {
+	Convey("A Push Notifications Instance with a delivery rate", t, func() {
+		var requestTimes []time.Time
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestTimes = append(requestTimes, time.Now())
+			w.Write([]byte(`{"publishId":"pub-123"}`))
+		}))
+		defer testServer.Close()
+
+		Convey("should not be created with a non-positive rate", func() {
+			noPN, err := New(testInstanceId, testSecretKey, WithDeliveryRate(0))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Delivery rate must be positive")
+			So(noPN, ShouldBeNil)
+		})
+
+		Convey("should space out publishes according to the rate", func() {
+			pn, err := New(testInstanceId, testSecretKey,
+				WithCustomBaseURL(testServer.URL),
+				WithDeliveryRate(20),
+			)
+			So(err, ShouldBeNil)
+
+			for i := 0; i < 4; i++ {
+				_, err := pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+				So(err, ShouldBeNil)
+			}
+
+			So(requestTimes, ShouldHaveLength, 4)
+			for i := 1; i < len(requestTimes); i++ {
+				So(requestTimes[i].Sub(requestTimes[i-1]), ShouldBeGreaterThanOrEqualTo, 40*time.Millisecond)
+			}
+		})
+	})
+}
@@ -0,0 +1,23 @@
+package pushnotifications
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// Makes the HTTP client send requests through the proxy set with `WithProxy`,
+// if any. Only `*http.Transport` can be configured from here, so other
+// transports are rejected rather than silently bypassing the proxy.
+func (pn *pushNotifications) applyProxy() error {
+	if pn.proxyURL == nil {
+		return nil
+	}
+
+	transport, err := pn.mutableTransport()
+	if err != nil {
+		return errors.Wrap(err, "Proxy cannot be used")
+	}
+	transport.Proxy = http.ProxyURL(pn.proxyURL)
+	return nil
+}
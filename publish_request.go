@@ -0,0 +1,180 @@
+package pushnotifications
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Builds the `request` map taken by the publish methods, one platform
+// payload at a time:
+//
+//	request := pushnotifications.NewPublishRequest().
+//		WithAPNS(apnsPayload).
+//		WithFCM(fcmPayload).
+//		Build()
+type PublishRequest struct {
+	payloads map[string]interface{}
+}
+
+// Creates an empty `PublishRequest`.
+func NewPublishRequest() *PublishRequest {
+	return &PublishRequest{
+		payloads: map[string]interface{}{},
+	}
+}
+
+// Creates a `PublishRequest` from authored JSON, such as a template loaded
+// from disk: an object with any of the `apns`, `fcm` and `web` platform
+// payloads. Returns an error if the JSON is invalid, has other top-level keys,
+// or doesn't pass `Validate`.
+func PublishRequestFromJSON(requestJSON []byte) (*PublishRequest, error) {
+	var payloads map[string]json.RawMessage
+	if err := json.Unmarshal(requestJSON, &payloads); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse the publish request JSON")
+	}
+
+	r := NewPublishRequest()
+	for platform, rawPayload := range payloads {
+		if platform != "apns" && platform != "fcm" && platform != "web" {
+			return nil, errors.Errorf("Unknown key `%s` in the publish request JSON: expected apns, fcm or web", printable(platform))
+		}
+
+		// Numbers are kept as they were written, rather than as float64s.
+		decoder := json.NewDecoder(bytes.NewReader(rawPayload))
+		decoder.UseNumber()
+		var payload map[string]interface{}
+		if err := decoder.Decode(&payload); err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse the `%s` payload of the publish request JSON", platform)
+		}
+		r.with(platform, payload)
+	}
+
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+var publishRequestPool = sync.Pool{
+	New: func() interface{} {
+		return NewPublishRequest()
+	},
+}
+
+// Returns an empty `PublishRequest` from a shared pool, to reduce allocations
+// when building many requests per second. Hand it back with
+// `PutPublishRequest` once the map returned by `Build` has been published.
+func GetPublishRequest() *PublishRequest {
+	return publishRequestPool.Get().(*PublishRequest)
+}
+
+// Resets `r` and returns it to the pool used by `GetPublishRequest`.
+//
+// `r` must not be used after this call, in particular not by another
+// goroutine that is still building or publishing it. Maps previously returned
+// by `Build` remain valid, but still share the platform payloads they were
+// built from.
+func PutPublishRequest(r *PublishRequest) {
+	r.Reset()
+	publishRequestPool.Put(r)
+}
+
+// Sets the payload sent to iOS devices.
+func (r *PublishRequest) WithAPNS(payload map[string]interface{}) *PublishRequest {
+	return r.with("apns", payload)
+}
+
+// Sets the payload sent to Android devices.
+func (r *PublishRequest) WithFCM(payload map[string]interface{}) *PublishRequest {
+	return r.with("fcm", payload)
+}
+
+// Sets the payload sent to web browsers.
+func (r *PublishRequest) WithWeb(payload map[string]interface{}) *PublishRequest {
+	return r.with("web", payload)
+}
+
+func (r *PublishRequest) with(platform string, payload map[string]interface{}) *PublishRequest {
+	r.payloads[platform] = payload
+	return r
+}
+
+// Returns a new request map, ready to be passed to the publish methods.
+func (r *PublishRequest) Build() map[string]interface{} {
+	request := make(map[string]interface{}, len(r.payloads))
+	for platform, payload := range r.payloads {
+		request[platform] = payload
+	}
+
+	return request
+}
+
+// Returns an error wrapping `ErrNoPlatforms` if no platform payload has been
+// set, or if every payload set is empty. Notification content isn't required:
+// a payload carrying only `data`, such as a silent or background update, is
+// valid.
+func (r *PublishRequest) Validate() error {
+	for _, payload := range r.payloads {
+		if len(payload.(map[string]interface{})) > 0 {
+			return nil
+		}
+	}
+
+	return errors.Wrap(ErrNoPlatforms, "Publish request has no platform payloads: set at least one of APNs, FCM or Web")
+}
+
+// Like `Validate`, but also returns an error wrapping `ErrPayloadTooLarge` if
+// the JSON encoding of the built request is larger than `maxBytes`, e.g. to
+// catch oversized templated content during development. The size doesn't
+// include the interests or user ids added when publishing.
+func (r *PublishRequest) ValidateWithMaxBytes(maxBytes int) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+
+	requestBytes, err := marshalWithoutHTMLEscaping(r.payloads)
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal the publish request JSON body")
+	}
+	if len(requestBytes) > maxBytes {
+		return errors.Wrapf(ErrPayloadTooLarge,
+			"Publish request is %d bytes, which is over the limit of %d bytes", len(requestBytes), maxBytes)
+	}
+
+	return nil
+}
+
+// Removes every payload, so that `r` can be used to build another request.
+func (r *PublishRequest) Reset() {
+	for platform := range r.payloads {
+		delete(r.payloads, platform)
+	}
+}
+
+// Creates a request for a silent APNs background update, carrying `data` to
+// the app without alerting the user: `content-available` is set, the push
+// type is `background` and the priority is 5, as Apple requires.
+// Returns an error if `data` tries to set any `aps` fields (such as an alert).
+func NewAPNSBackgroundRequest(data map[string]interface{}) (map[string]interface{}, error) {
+	if _, ok := data["aps"]; ok {
+		return nil, errors.New("Background requests cannot set `aps` fields, as they must not alert the user")
+	}
+
+	apns := map[string]interface{}{
+		"aps": map[string]interface{}{
+			"content-available": 1,
+		},
+		"headers": map[string]interface{}{
+			"apns-push-type": "background",
+			"apns-priority":  "5",
+		},
+	}
+	if data != nil {
+		apns["data"] = data
+	}
+
+	return NewPublishRequest().WithAPNS(apns).Build(), nil
+}
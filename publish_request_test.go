@@ -0,0 +1,226 @@
+package pushnotifications
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var (
+	testAPNSPayload = map[string]interface{}{
+		"aps": map[string]interface{}{
+			"alert": map[string]interface{}{
+				"title": "Hello",
+				"body":  "Hello, world",
+			},
+		},
+	}
+	testFCMPayload = map[string]interface{}{
+		"notification": map[string]interface{}{
+			"title": "Hello",
+			"body":  "Hello, world",
+		},
+	}
+)
+
+func TestPublishRequest(t *testing.T) {
+	Convey("A Publish Request builder", t, func() {
+		Convey("should build a request with every platform payload given", func() {
+			request := NewPublishRequest().
+				WithAPNS(testAPNSPayload).
+				WithFCM(testFCMPayload).
+				Build()
+
+			So(request, ShouldResemble, map[string]interface{}{
+				"apns": testAPNSPayload,
+				"fcm":  testFCMPayload,
+			})
+		})
+
+		Convey("should build a request that is unaffected by reusing the builder", func() {
+			builder := GetPublishRequest()
+			request := builder.WithFCM(testFCMPayload).Build()
+			PutPublishRequest(builder)
+
+			builder = GetPublishRequest()
+			So(builder.Build(), ShouldBeEmpty)
+			builder.WithAPNS(testAPNSPayload)
+
+			So(request, ShouldResemble, map[string]interface{}{"fcm": testFCMPayload})
+		})
+
+		Convey("should fail to validate without any platform payloads", func() {
+			err := NewPublishRequest().Validate()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "no platform payloads")
+			So(errors.Is(err, ErrNoPlatforms), ShouldBeTrue)
+			So(NewPublishRequest().WithWeb(testFCMPayload).Validate(), ShouldBeNil)
+		})
+
+		Convey("should fail to validate with only empty platform payloads", func() {
+			err := NewPublishRequest().WithFCM(map[string]interface{}{}).WithAPNS(nil).Validate()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "no platform payloads")
+			So(errors.Is(err, ErrNoPlatforms), ShouldBeTrue)
+		})
+
+		Convey("should validate a data-only request without notification content", func() {
+			builder := NewPublishRequest().WithFCM(map[string]interface{}{
+				"data": map[string]interface{}{"orderId": "o-123"},
+			})
+			So(builder.Validate(), ShouldBeNil)
+
+			background, err := NewAPNSBackgroundRequest(map[string]interface{}{"orderId": "o-123"})
+			So(err, ShouldBeNil)
+			So(NewPublishRequest().WithAPNS(background["apns"].(map[string]interface{})).Validate(), ShouldBeNil)
+		})
+
+		Convey("should validate a request within the byte budget", func() {
+			builder := NewPublishRequest().WithAPNS(testAPNSPayload).WithFCM(testFCMPayload)
+			requestBytes, _ := json.Marshal(builder.Build())
+
+			So(builder.ValidateWithMaxBytes(len(requestBytes)), ShouldBeNil)
+		})
+
+		Convey("should report missing platform payloads before the size", func() {
+			err := NewPublishRequest().ValidateWithMaxBytes(0)
+			So(errors.Is(err, ErrNoPlatforms), ShouldBeTrue)
+			So(errors.Is(err, ErrPayloadTooLarge), ShouldBeFalse)
+		})
+
+		Convey("should fail to validate a request over the byte budget", func() {
+			builder := NewPublishRequest().WithAPNS(testAPNSPayload).WithFCM(testFCMPayload)
+			requestBytes, _ := json.Marshal(builder.Build())
+
+			err := builder.ValidateWithMaxBytes(len(requestBytes) - 1)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "over the limit")
+			So(errors.Is(err, ErrPayloadTooLarge), ShouldBeTrue)
+		})
+
+		Convey("should measure the request as sent, without escaping HTML characters", func() {
+			builder := NewPublishRequest().WithFCM(map[string]interface{}{
+				"notification": map[string]interface{}{"body": "<b>Fish & chips</b>"},
+			})
+			requestBytes, err := marshalWithoutHTMLEscaping(builder.Build())
+			So(err, ShouldBeNil)
+
+			So(builder.ValidateWithMaxBytes(len(requestBytes)), ShouldBeNil)
+		})
+	})
+}
+
+func TestPublishRequestFromJSON(t *testing.T) {
+	Convey("A Publish Request created from JSON", t, func() {
+		Convey("should be published as it was authored", func() {
+			var requestBody map[string]interface{}
+			testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&requestBody)
+				w.Write([]byte(`{"publishId":"pub-123"}`))
+			}))
+			defer testServer.Close()
+			pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL))
+			So(err, ShouldBeNil)
+
+			builder, err := PublishRequestFromJSON([]byte(`{
+				"apns": {"aps": {"alert": {"title": "Hello", "body": "Hello, world"}}},
+				"fcm": {"notification": {"title": "Hello", "body": "Hello, world"}, "data": {"orderId": 9007199254740993}}
+			}`))
+			So(err, ShouldBeNil)
+
+			publishId, err := pn.PublishToInterests([]string{"hello"}, builder.Build())
+			So(err, ShouldBeNil)
+			So(publishId, ShouldEqual, "pub-123")
+			So(requestBody["apns"], ShouldResemble, map[string]interface{}{
+				"aps": map[string]interface{}{
+					"alert": map[string]interface{}{"title": "Hello", "body": "Hello, world"},
+				},
+			})
+			So(requestBody["interests"], ShouldResemble, []interface{}{"hello"})
+
+			data := builder.Build()["fcm"].(map[string]interface{})["data"].(map[string]interface{})
+			So(data["orderId"], ShouldEqual, json.Number("9007199254740993"))
+		})
+
+		Convey("should reject unknown top-level keys", func() {
+			builder, err := PublishRequestFromJSON([]byte(`{"fcm": {"data": {}}, "interests": ["hello"]}`))
+			So(builder, ShouldBeNil)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Unknown key `interests`")
+		})
+
+		Convey("should reject invalid JSON and payloads", func() {
+			for _, requestJSON := range []string{`{"fcm":`, `["fcm"]`, `{"fcm": "hello"}`, `{}`} {
+				builder, err := PublishRequestFromJSON([]byte(requestJSON))
+				So(builder, ShouldBeNil)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestAPNSBackgroundRequest(t *testing.T) {
+	Convey("An APNs background request", t, func() {
+		Convey("should match Apple's requirements for background updates", func() {
+			request, err := NewAPNSBackgroundRequest(map[string]interface{}{"sync": "inbox"})
+			So(err, ShouldBeNil)
+
+			body, err := json.Marshal(request)
+			So(err, ShouldBeNil)
+			So(string(body), ShouldEqual,
+				`{"apns":{"aps":{"content-available":1},"data":{"sync":"inbox"},`+
+					`"headers":{"apns-priority":"5","apns-push-type":"background"}}}`)
+		})
+
+		Convey("should not have an alert, sound or badge", func() {
+			request, err := NewAPNSBackgroundRequest(nil)
+			So(err, ShouldBeNil)
+
+			aps := request["apns"].(map[string]interface{})["aps"].(map[string]interface{})
+			So(aps, ShouldResemble, map[string]interface{}{"content-available": 1})
+		})
+
+		Convey("should not let the data set `aps` fields", func() {
+			request, err := NewAPNSBackgroundRequest(map[string]interface{}{
+				"aps": map[string]interface{}{"alert": "Hello"},
+			})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "cannot set `aps` fields")
+			So(request, ShouldBeNil)
+		})
+	})
+}
+
+// Keep the builders and requests alive, as they would be when handed around
+// by a real sender, so that the benchmarks measure real allocations.
+var (
+	benchmarkBuilder *PublishRequest
+	benchmarkRequest map[string]interface{}
+)
+
+func BenchmarkPublishRequestNew(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		benchmarkBuilder = NewPublishRequest()
+		benchmarkRequest = benchmarkBuilder.
+			WithAPNS(testAPNSPayload).
+			WithFCM(testFCMPayload).
+			Build()
+	}
+}
+
+func BenchmarkPublishRequestPooled(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		benchmarkBuilder = GetPublishRequest()
+		benchmarkRequest = benchmarkBuilder.
+			WithAPNS(testAPNSPayload).
+			WithFCM(testFCMPayload).
+			Build()
+		PutPublishRequest(benchmarkBuilder)
+	}
+}
@@ -2,13 +2,21 @@ package pushnotifications
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
+	"unicode"
 	"unicode/utf8"
 
 	jwt "github.com/dgrijalva/jwt-go"
@@ -16,45 +24,228 @@ import (
 )
 
 // The Pusher Push Notifications Server API client
+//
+// The bodies of publishes made with a request map are deterministic: the keys
+// of every map in the request, however deeply nested, are sorted, and the
+// interests or user ids follow them in the order given, so the same request
+// always produces the same bytes. The `PublishRaw*` methods send the payload's
+// bytes as given instead, with the interests or user ids added at the end.
 type PushNotifications interface {
 	// Publishes notifications to all devices subscribed to at least 1 of the interests given
 	// Returns a non-empty `publishId` JSON string if successful; or a non-nil `error` otherwise.
 	PublishToInterests(interests []string, request map[string]interface{}) (publishId string, err error)
 
-	// DEPRECATED. An alias for `PublishToInterests`
+	// Like `PublishToInterests`, but the publish is abandoned if `ctx` is done before it completes,
+	// in which case the returned error wraps `ctx.Err()`.
+	PublishToInterestsWithContext(ctx context.Context, interests []string, request map[string]interface{}) (publishId string, err error)
+
+	// Like `PublishToInterests`, but returns a `PublishResult` with details about the publish
+	// instead of just the `publishId`.
+	PublishToInterestsWithResult(interests []string, request map[string]interface{}) (result PublishResult, err error)
+
+	// Starts publishing like `PublishToInterestsWithContext`, without waiting for the publish to finish.
+	// Returns a `PublishFuture` to get the result from, or to cancel the publish with.
+	PublishToInterestsAsync(ctx context.Context, interests []string, request map[string]interface{}) (future *PublishFuture)
+
+	// Like `PublishToInterests`, but for a request that is already JSON. The interests are
+	// added to the end of the `payload` object, and its other bytes are sent unchanged.
+	PublishRawToInterests(interests []string, payload json.RawMessage) (publishId string, err error)
+
+	// DEPRECATED. An alias for `PublishRawToInterests`, unless `WithDeprecatedMethodsDisabled` is used,
+	// in which case it always returns a non-nil `error`.
+	PublishToInterestsRawPayload(interests []string, payload json.RawMessage) (publishId string, err error)
+
+	// DEPRECATED. An alias for `PublishToInterests`, unless `WithDeprecatedMethodsDisabled` is used,
+	// in which case it always returns a non-nil `error`.
 	Publish(interests []string, request map[string]interface{}) (publishId string, err error)
 
 	// Publishes notifications to all devices associated with the given user ids
 	// Returns a non-empty `publishId` JSON string successful, or a non-nil `error` otherwise.
 	PublishToUsers(users []string, request map[string]interface{}) (publishId string, err error)
 
+	// Like `PublishToUsers`, but the publish is abandoned if `ctx` is done before it completes,
+	// in which case the returned error wraps `ctx.Err()`.
+	PublishToUsersWithContext(ctx context.Context, users []string, request map[string]interface{}) (publishId string, err error)
+
+	// Like `PublishToUsers`, but for a request that is already JSON. The user ids are
+	// added to the end of the `payload` object, and its other bytes are sent unchanged.
+	PublishRawToUsers(users []string, payload json.RawMessage) (publishId string, err error)
+
+	// Publishes to any number of interests, by splitting them into chunks of up to
+	// `MaxInterestsPerPublish`, or the limit set with `WithMaxInterests`. Returns the
+	// publish id of every chunk, in order.
+	// Stops at the first chunk that fails, returning the publish ids of the chunks
+	// before it along with a non-nil `error`. With `WithContinueOnBatchError`, every
+	// chunk is published, failed chunks get an empty publish id, and the `error` is a
+	// `*BatchError` holding every failure.
+	PublishToInterestsBatched(interests []string, request map[string]interface{}) (publishIds []string, err error)
+
+	// Publishes to any number of users, by splitting them into chunks the API accepts.
+	// Every chunk is published even if some fail; the returned `BatchSummary` tells which did.
+	// Returns a non-nil `error` if no users are given, or if any chunk failed, in which case
+	// the summary still holds the results of the chunks that were published: check it
+	// before retrying, so that those users aren't notified twice.
+	PublishToUsersBatched(users []string, request map[string]interface{}) (summary BatchSummary, err error)
+
 	// Creates a signed JWT for a user id.
 	// Returns a signed JWT if successful, or a non-nil `error` otherwise.
 	GenerateToken(userId string) (token map[string]interface{}, err error)
 
+	// Like `GenerateToken`, but returns a `BeamsToken`, which marshals to the JSON the Beams
+	// client SDKs expect from your auth endpoint.
+	GenerateBeamsToken(userId string) (token BeamsToken, err error)
+
+	// Like `GenerateToken`, but returns the signed JWT as a string along with the claims it contains.
+	GenerateTokenWithClaimsResult(userId string) (token string, claims jwt.MapClaims, err error)
+
+	// Checks that `token` is a valid, unexpired Beams token generated for this instance.
+	// Returns the user id it was generated for, or a non-nil `error` wrapping `ErrTokenMalformed`,
+	// `ErrTokenSignatureInvalid`, `ErrTokenExpired` or `ErrTokenIssuerMismatch` otherwise.
+	VerifyToken(token string) (userId string, err error)
+
+	// Generates signed JWTs for many user ids at once, signing up to `concurrency` in parallel
+	// (or one per CPU if `concurrency` isn't positive).
+	// Returns the tokens and the errors keyed by user id. Users not processed before `ctx` is done
+	// get the context's error.
+	GenerateTokensConcurrent(ctx context.Context, userIds []string, concurrency int) (tokens map[string]string, errs map[string]error)
+
+	// Creates a `Batcher` running publishes and user deletions on up to `workers` at once
+	// (or one per CPU if `workers` isn't positive).
+	NewBatcher(workers int) (batcher *Batcher)
+
 	// Contacts the Beams service to remove all the devices of the given user
 	// Return a non-nil `error` if there's a problem.
 	DeleteUser(userId string) (err error)
+
+	// Like `DeleteUser`, but the deletion is abandoned if `ctx` is done before it completes,
+	// in which case the returned error wraps `ctx.Err()`.
+	DeleteUserWithContext(ctx context.Context, userId string) (err error)
+
+	// Returns a snapshot of counters about the requests made to the Beams service so far.
+	Stats() Stats
+
+	// Returns the requests recorded so far with `WithTestMode`, in the order they were made,
+	// or nil without it.
+	RecordedRequests() []RecordedRequest
 }
 
+// The most interests a single publish can target.
+const MaxInterestsPerPublish = 100
+
+// The most user ids a single publish can target.
+const MaxUsersPerPublish = 1000
+
 const (
-	defaultRequestTimeout       = time.Minute
-	defaultBaseEndpointFormat   = "https://%s.pushnotifications.pusher.com"
-	maxUserIdLength             = 164
-	maxNumUserIdsWhenPublishing = 1000
-	tokenTTL                    = 24 * time.Hour
+	defaultRequestTimeout         = time.Minute
+	defaultBaseEndpointHostSuffix = ".pushnotifications.pusher.com"
+	defaultAuthScheme             = "Bearer"
+	maxUserIdLength               = 164
+	maxInterestLength             = 164
+	defaultTokenTTL               = 24 * time.Hour
+	// How long before it is issued a token becomes valid, so that verifiers
+	// with a clock slightly behind ours accept it straight away.
+	tokenNotBeforeLeeway = time.Minute
 )
 
 var (
 	interestValidationRegex = regexp.MustCompile(`^[a-zA-Z0-9_\-=@,.;]+$`)
+	numericInterestRegex    = regexp.MustCompile(`^[0-9]+$`)
+	alphanumericRegex       = regexp.MustCompile(`[a-zA-Z0-9]`)
+	uuidRegex               = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hexSecretRegex          = regexp.MustCompile(`^[0-9a-fA-F]{32,}$`)
 )
 
 type pushNotifications struct {
 	InstanceId string
 	SecretKey  string
 
-	baseEndpoint string
+	baseEndpoint *url.URL
 	httpClient   *http.Client
+
+	maxAttempts    int
+	retryBaseDelay time.Duration
+	backoff        BackoffStrategy
+
+	contextRequestIdKey    interface{}
+	contextRequestIdHeader string
+
+	authScheme string
+
+	logger                         Logger
+	warnNumericInterests           bool
+	rejectPunctuationOnlyInterests bool
+
+	// Holds a token for every request in flight, when concurrency is limited.
+	concurrencySemaphore chan struct{}
+
+	strictValidation bool
+
+	requiredInterestPrefix string
+	autoInterestPrefix     string
+	sortInterests          bool
+
+	tokenTTL          time.Duration
+	tokenExpiryBuffer time.Duration
+
+	stats *statsCounters
+
+	clientTrace func(ctx context.Context) *httptrace.ClientTrace
+
+	// Paces publishes when a delivery rate is set.
+	deliveryPacer *pacer
+
+	payloadEnvelopeKey string
+
+	requireNonEmptyPublishId bool
+
+	deprecatedMethodsDisabled bool
+
+	fallbackSecretKey string
+
+	responseInspector func(*http.Response)
+
+	perAttemptTimeout time.Duration
+
+	maxTotalInterests int
+
+	maxInterests       int
+	maxUsersPerPublish int
+	maxInterestLength  int
+
+	continueOnBatchError bool
+
+	minTLSVersion uint16
+
+	eventListener func(Event)
+
+	maxPayloadDepth int
+
+	signingMethod jwt.SigningMethod
+	signingKey    interface{}
+	signingKeyId  string
+
+	logResponseBodyBytes int
+
+	tracer  Tracer
+	metrics MetricsRecorder
+
+	librarySuffix string
+	extraHeaders  http.Header
+	proxyURL      *url.URL
+	tlsConfig     *tls.Config
+
+	testModeTransport *recordingTransport
+	// The clone of the default or caller's transport configured by the options.
+	ownTransport *http.Transport
+
+	retryableErrorCodes map[string]bool
+
+	platforms []string
+
+	maxPayloadBytes int
+
+	// The first error reported by an `Option`, returned from `New`.
+	optionErr error
 }
 
 // Creates a New `PushNotifications` instance.
@@ -66,20 +257,69 @@ func New(instanceId string, secretKey string, options ...Option) (PushNotificati
 	if secretKey == "" {
 		return nil, errors.New("Secret Key cannot be an empty string")
 	}
+	if !validSecretKey(secretKey) {
+		return nil, errors.New("Secret Key must be valid utf8 and cannot contain control characters")
+	}
 
 	pn := &pushNotifications{
 		InstanceId: instanceId,
 		SecretKey:  secretKey,
 
-		baseEndpoint: fmt.Sprintf(defaultBaseEndpointFormat, instanceId),
+		baseEndpoint: &url.URL{Scheme: "https", Host: instanceId + defaultBaseEndpointHostSuffix},
 		httpClient: &http.Client{
 			Timeout: defaultRequestTimeout,
 		},
+
+		maxAttempts:    1,
+		retryBaseDelay: defaultRetryBaseDelay,
+
+		authScheme: defaultAuthScheme,
+
+		logger: noopLogger{},
+
+		stats: &statsCounters{},
+
+		tokenTTL: defaultTokenTTL,
+
+		platforms: defaultPlatforms,
+
+		maxPayloadBytes: defaultMaxPayloadBytes,
+
+		maxInterests:       MaxInterestsPerPublish,
+		minTLSVersion:      defaultMinTLSVersion,
+		maxUsersPerPublish: MaxUsersPerPublish,
+		maxInterestLength:  maxInterestLength,
 	}
 
 	for _, option := range options {
 		option(pn)
 	}
+	if pn.optionErr != nil {
+		return nil, pn.optionErr
+	}
+	// Checked here, as the options may be given in any order.
+	if pn.tokenExpiryBuffer >= pn.tokenTTL {
+		return nil, errors.Errorf(
+			"Token expiry buffer must be between 0 and the token lifetime (%s), got %s", pn.tokenTTL, pn.tokenExpiryBuffer)
+	}
+	if err := pn.applyProxy(); err != nil {
+		return nil, err
+	}
+	if err := pn.applyTLSConfig(); err != nil {
+		return nil, err
+	}
+	pn.enforceMinTLSVersion()
+	if pn.testModeTransport != nil {
+		httpClient := *pn.httpClient
+		httpClient.Transport = pn.testModeTransport
+		pn.httpClient = &httpClient
+	}
+
+	if pn.strictValidation && hexSecretRegex.MatchString(instanceId) && uuidRegex.MatchString(secretKey) {
+		return nil, errors.New(
+			"Instance Id looks like a Secret Key and Secret Key looks like an Instance Id: " +
+				"the arguments may be swapped (expected `New(instanceId, secretKey)`)")
+	}
 
 	return pn, nil
 }
@@ -94,133 +334,371 @@ type errorResponse struct {
 }
 
 func (pn *pushNotifications) GenerateToken(userId string) (map[string]interface{}, error) {
-	if len(userId) == 0 {
-		return nil, errors.New("User Id cannot be empty")
+	beamsToken, err := pn.GenerateBeamsToken(userId)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(userId) > maxUserIdLength {
-		return nil, errors.Errorf(
-			"User Id ('%s') length too long (expected fewer than %d characters, got %d)",
-			userId, maxUserIdLength+1, len(userId))
+	tokenMap := map[string]interface{}{
+		"token": beamsToken.Token,
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub": userId,
-		"exp": time.Now().Add(tokenTTL).Unix(),
-		"iss": "https://" + pn.InstanceId + ".pushnotifications.pusher.com",
-	})
+	return tokenMap, nil
+}
 
-	tokenString, signingErrorErr := token.SignedString([]byte(pn.SecretKey))
-	if signingErrorErr != nil {
-		return nil, errors.Wrap(signingErrorErr, "Failed to sign the JWT token used for User Authentication")
+func (pn *pushNotifications) GenerateTokenWithClaimsResult(userId string) (_ string, _ jwt.MapClaims, err error) {
+	defer func() {
+		pn.emitEvent(EventGenerateToken, "GenerateToken", func() string { return summariseTargets("users", []string{userId}) }, err)
+	}()
+
+	if rule, err := userIdError(userId); err != nil {
+		return "", nil, pn.validationFailed(rule, userId, err)
 	}
 
-	tokenMap := map[string]interface{}{
-		"token": tokenString,
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub": userId,
+		"iat": now.Unix(),
+		"nbf": now.Add(-tokenNotBeforeLeeway).Unix(),
+		"exp": now.Add(pn.tokenTTL - pn.tokenExpiryBuffer).Unix(),
+		"iss": pn.tokenIssuer(),
+	}
+	signingMethod, signingKey := pn.tokenSigning()
+	token := jwt.NewWithClaims(signingMethod, claims)
+	if pn.signingKeyId != "" {
+		token.Header["kid"] = pn.signingKeyId
 	}
 
-	return tokenMap, nil
+	tokenString, signingErrorErr := token.SignedString(signingKey)
+	if signingErrorErr != nil {
+		return "", nil, errors.Wrap(signingErrorErr, "Failed to sign the JWT token used for User Authentication")
+	}
+
+	return tokenString, claims, nil
 }
 
 // Deprecated: Use PublishToInterests instead
 func (pn *pushNotifications) Publish(interests []string, request map[string]interface{}) (string, error) {
+	if pn.deprecatedMethodsDisabled {
+		return "", errors.New("Publish is deprecated and has been disabled: use PublishToInterests instead")
+	}
 	return pn.PublishToInterests(interests, request)
 }
 
 func (pn *pushNotifications) PublishToInterests(interests []string, request map[string]interface{}) (string, error) {
+	result, err := pn.publishToInterests(context.Background(), interests, request)
+	return result.PublishId, err
+}
+
+func (pn *pushNotifications) PublishToInterestsWithContext(ctx context.Context, interests []string, request map[string]interface{}) (string, error) {
+	result, err := pn.publishToInterests(ctx, interests, request)
+	return result.PublishId, err
+}
+
+func (pn *pushNotifications) PublishToInterestsWithResult(interests []string, request map[string]interface{}) (PublishResult, error) {
+	return pn.publishToInterests(context.Background(), interests, request)
+}
+
+func (pn *pushNotifications) publishToInterests(ctx context.Context, interests []string, request map[string]interface{}) (result PublishResult, err error) {
+	defer func() {
+		pn.emitEvent(EventPublish, "PublishToInterests", func() string { return summariseTargets("interests", interests) }, err)
+	}()
+	validationStart := time.Now()
+
+	interests = pn.sortAndDeduplicate(pn.applyInterestPrefix(interests))
+	if err := pn.validateInterests(interests); err != nil {
+		return PublishResult{}, err
+	}
+	if err := pn.validatePayload(request); err != nil {
+		return PublishResult{}, err
+	}
+
+	bodyRequestBytes, err := pn.marshalPublishBody(request, "interests", interests)
+	if err != nil {
+		return PublishResult{}, err
+	}
+
+	path := fmt.Sprintf("/publish_api/v1/instances/%s/publishes", pn.InstanceId)
+	validationDuration := time.Since(validationStart)
+
+	result, err = pn.publishToAPI(ctx, "PublishToInterests", path, bodyRequestBytes)
+	if err != nil {
+		return PublishResult{}, err
+	}
+	result.ValidationDuration = validationDuration
+	return result, nil
+}
+
+// Prepends the prefix set with `WithInterestPrefixAutoApply`, if any, to each of
+// `interests`. Returns a new slice, leaving the caller's unchanged.
+func (pn *pushNotifications) applyInterestPrefix(interests []string) []string {
+	if pn.autoInterestPrefix == "" {
+		return interests
+	}
+
+	prefixed := make([]string, len(interests))
+	for i, interest := range interests {
+		prefixed[i] = pn.autoInterestPrefix + interest
+	}
+	return prefixed
+}
+
+// Sorts `interests` and removes duplicates, if asked to with
+// `WithSortInterests`. Returns a new slice, leaving the caller's unchanged.
+func (pn *pushNotifications) sortAndDeduplicate(interests []string) []string {
+	if !pn.sortInterests {
+		return interests
+	}
+
+	sorted := append([]string(nil), interests...)
+	sort.Strings(sorted)
+	deduplicated := sorted[:0]
+	for _, interest := range sorted {
+		if len(deduplicated) == 0 || interest != deduplicated[len(deduplicated)-1] {
+			deduplicated = append(deduplicated, interest)
+		}
+	}
+	return deduplicated
+}
+
+// Checks that `interests` can be published to in a single publish.
+func (pn *pushNotifications) validateInterests(interests []string) error {
 	if len(interests) == 0 {
 		// this request was not very interesting :/
-		return "", errors.New("No interests were supplied")
+		return pn.validationFailed(ruleNoInterests, len(interests), errors.Wrap(ErrNoInterests, "No interests were supplied"))
 	}
 
-	if len(interests) > 100 {
-		return "",
-			errors.Errorf("Too many interests supplied (%d): API only supports up to 100", len(interests))
+	if len(interests) > pn.maxInterests {
+		return pn.validationFailed(ruleTooManyInterests, len(interests),
+			errors.Wrapf(ErrTooManyInterests, "Too many interests supplied (%d): API only supports up to %d", len(interests), pn.maxInterests))
 	}
 
 	for _, interest := range interests {
-		if len(interest) == 0 {
-			return "", errors.New("An empty interest name is not valid")
+		if rule, err := interestError(interest, pn.maxInterestLength); err != nil {
+			return pn.validationFailed(rule, interest, err)
+		}
+
+		if !strings.HasPrefix(interest, pn.requiredInterestPrefix) {
+			return pn.validationFailed(ruleInterestMissingPrefix, interest,
+				errors.Wrapf(ErrInvalidInterestName, "Interest `%s` does not start with the required prefix `%s`", interest, pn.requiredInterestPrefix))
 		}
 
-		if len(interest) > 164 {
-			return "",
-				errors.Errorf("Interest length is %d which is over 164 characters", len(interest))
+		if pn.rejectPunctuationOnlyInterests && !alphanumericRegex.MatchString(interest) {
+			return pn.validationFailed(ruleInterestPunctuationOnly, interest,
+				errors.Wrapf(ErrInvalidInterestName, "Interest `%s` has no letters or numbers", interest))
 		}
 
-		if !interestValidationRegex.MatchString(interest) {
-			return "",
-				errors.Errorf(
-					"Interest `%s` contains an forbidden character: "+
-						"Allowed characters are: ASCII upper/lower-case letters, "+
-						"numbers or one of _-=@,.:",
-					interest)
+		if pn.warnNumericInterests && numericInterestRegex.MatchString(interest) {
+			pn.logger.Warnf("Interest `%s` is purely numeric and may be mistaken for a user id", interest)
 		}
 	}
-	// TODO: don't mutate `request`
-	request["interests"] = interests
-	bodyRequestBytes, err := json.Marshal(request)
+
+	return nil
+}
+
+func (pn *pushNotifications) PublishToUsers(users []string, request map[string]interface{}) (string, error) {
+	result, err := pn.publishToUsers(context.Background(), users, request)
+	return result.PublishId, err
+}
+
+func (pn *pushNotifications) PublishToUsersWithContext(ctx context.Context, users []string, request map[string]interface{}) (string, error) {
+	result, err := pn.publishToUsers(ctx, users, request)
+	return result.PublishId, err
+}
+
+func (pn *pushNotifications) publishToUsers(ctx context.Context, users []string, request map[string]interface{}) (result PublishResult, err error) {
+	defer func() {
+		pn.emitEvent(EventPublish, "PublishToUsers", func() string { return summariseTargets("users", users) }, err)
+	}()
+	validationStart := time.Now()
+
+	if err := pn.validateUsers(users); err != nil {
+		return PublishResult{}, err
+	}
+	if err := pn.validatePayload(request); err != nil {
+		return PublishResult{}, err
+	}
+
+	bodyRequestBytes, err := pn.marshalPublishBody(request, "users", users)
 	if err != nil {
-		return "", errors.Wrap(err, "Failed to marshal the publish request JSON body")
+		return PublishResult{}, err
 	}
 
-	URL := fmt.Sprintf(pn.baseEndpoint+"/publish_api/v1/instances/%s/publishes", pn.InstanceId)
-	return pn.publishToAPI(URL, bodyRequestBytes)
+	path := fmt.Sprintf("/publish_api/v1/instances/%s/publishes/users", pn.InstanceId)
+	validationDuration := time.Since(validationStart)
+
+	result, err = pn.publishToAPI(ctx, "PublishToUsers", path, bodyRequestBytes)
+	if err != nil {
+		return PublishResult{}, err
+	}
+	result.ValidationDuration = validationDuration
+	return result, nil
 }
 
-func (pn *pushNotifications) PublishToUsers(users []string, request map[string]interface{}) (string, error) {
+// Checks that `users` can be published to in a single publish.
+func (pn *pushNotifications) validateUsers(users []string) error {
 	if len(users) == 0 {
-		return "", errors.New("Must supply at least one user id")
+		return pn.validationFailed(ruleNoUsers, len(users), errors.Wrap(ErrNoUsers, "Must supply at least one user id"))
 	}
-	if len(users) > maxNumUserIdsWhenPublishing {
-		return "", errors.New(
-			fmt.Sprintf("Too many user ids supplied. API supports up to %d, got %d", maxNumUserIdsWhenPublishing, len(users)),
-		)
+	if len(users) > pn.maxUsersPerPublish {
+		return pn.validationFailed(ruleTooManyUsers, len(users), errors.Wrapf(ErrTooManyUsers,
+			"Too many user ids supplied. API supports up to %d, got %d", pn.maxUsersPerPublish, len(users),
+		))
 	}
 	for i, userId := range users {
-		if userId == "" {
-			return "", errors.New("Empty user ids are not valid")
-		}
-		if len(userId) > maxUserIdLength {
-			return "", errors.New(
-				fmt.Sprintf("User Id ('%s') length too long (expected fewer than %d characters, got %d)", userId, maxUserIdLength, len(userId)),
-			)
+		switch rule := userIdRule(userId); rule {
+		case ruleEmptyUserId:
+			return pn.validationFailed(rule, userId, errors.Wrap(ErrInvalidUserId, "Empty user ids are not valid"))
+		case ruleUserIdTooLong:
+			return pn.validationFailed(rule, userId, errors.Wrapf(ErrUserIdTooLong,
+				"User Id ('%s') length too long (expected fewer than %d characters, got %d)", userId, maxUserIdLength, utf8.RuneCountInString(userId),
+			))
+		case ruleUserIdInvalidUTF8:
+			return pn.validationFailed(rule, userId, errors.Wrapf(ErrInvalidUserId, "User Id at index %d is not valid utf8", i))
 		}
-		// test for invalid characters
-		if !utf8.ValidString(userId) {
-			return "", errors.New(fmt.Sprintf("User Id at index %d is not valid utf8", i))
+	}
+
+	return nil
+}
+
+// Marshals the body of a publish of `request` to the `targets` under `targetKey`.
+// Map keys are sorted at every level, which keeps the body stable. Any
+// `targetKey` already in `request` is replaced.
+func (pn *pushNotifications) marshalPublishBody(request map[string]interface{}, targetKey string, targets []string) ([]byte, error) {
+	if _, ok := request[targetKey]; ok && pn.payloadEnvelopeKey == "" {
+		// Copy `request` rather than removing the key from it, as callers
+		// may share it between concurrent publishes.
+		withoutTargets := make(map[string]interface{}, len(request))
+		for key, value := range request {
+			if key != targetKey {
+				withoutTargets[key] = value
+			}
 		}
+		request = withoutTargets
 	}
-	// TODO: don't mutate `request`
-	request["users"] = users
-	bodyRequestBytes, err := json.Marshal(request)
+
+	payload, err := marshalWithoutHTMLEscaping(request)
 	if err != nil {
-		return "", errors.Wrap(err, "Failed to marshal the publish request JSON body")
+		return nil, errors.Wrap(err, "Failed to marshal the publish request JSON body")
 	}
 
-	URL := fmt.Sprintf("%s/publish_api/v1/instances/%s/publishes/users", pn.baseEndpoint, pn.InstanceId)
-	return pn.publishToAPI(URL, bodyRequestBytes)
+	return pn.addPublishTargets(payload, targetKey, targets)
 }
 
-func (pn *pushNotifications) publishToAPI(url string, bodyRequestBytes []byte) (string, error) {
-	httpReq, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(bodyRequestBytes))
+const jsonWhitespace = " \t\r\n"
+
+// Builds the body of a publish of `payload`, a JSON object with a platform
+// payload, to the `targets` under `targetKey`. The targets are added as the
+// last key of the object, so the bytes of `payload` are sent as they are.
+// Returns an error if `payload` is over the size limit.
+func (pn *pushNotifications) addPublishTargets(payload []byte, targetKey string, targets []string) ([]byte, error) {
+	if len(payload) > pn.maxPayloadBytes {
+		return nil, pn.validationFailed(rulePayloadTooLarge, len(payload), errors.Wrapf(ErrPayloadTooLarge,
+			"Publish request is %d bytes, over the limit of %d bytes", len(payload), pn.maxPayloadBytes))
+	}
+
+	targetsBytes, err := json.Marshal(targets)
 	if err != nil {
-		return "", errors.Wrap(err, "Failed to prepare the publish request")
+		return nil, errors.Wrap(err, "Failed to marshal the publish request JSON body")
+	}
+	keyBytes, err := json.Marshal(targetKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to marshal the publish request JSON body")
 	}
 
-	httpReq.Header.Add("Authorization", "Bearer "+pn.SecretKey)
-	httpReq.Header.Add("Content-Type", "application/json")
-	httpReq.Header.Add("X-Pusher-Library", "pusher-push-notifications-go "+sdkVersion)
+	if pn.payloadEnvelopeKey != "" {
+		envelopeKeyBytes, err := json.Marshal(pn.payloadEnvelopeKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to marshal the publish request JSON body")
+		}
+		// Both keys are ours, so keep them sorted like the rest of the body.
+		fields := [][]byte{
+			append(append(envelopeKeyBytes, ':'), payload...),
+			append(append(keyBytes, ':'), targetsBytes...),
+		}
+		if targetKey < pn.payloadEnvelopeKey {
+			fields[0], fields[1] = fields[1], fields[0]
+		}
+		return append(append([]byte{'{'}, bytes.Join(fields, []byte{','})...), '}'), nil
+	}
 
-	httpResp, err := pn.httpClient.Do(httpReq)
+	// Reopen the object by dropping its closing brace. It isn't empty, as it
+	// has a platform payload.
+	object := bytes.TrimRight(payload, jsonWhitespace)
+	body := &bytes.Buffer{}
+	body.Write(object[:len(object)-1])
+	body.WriteByte(',')
+	body.Write(keyBytes)
+	body.WriteByte(':')
+	body.Write(targetsBytes)
+	body.WriteByte('}')
+
+	return body.Bytes(), nil
+}
+
+// Like `json.Marshal`, but leaves `<`, `>` and `&` as they are rather than
+// escaping them, so that URLs in payloads are sent as given.
+func marshalWithoutHTMLEscaping(value interface{}) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+
+	// `Encode` ends the JSON with a newline, which `json.Marshal` doesn't.
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), nil
+}
+
+// Publishes to `path`, relative to the base endpoint, for the public `method`.
+func (pn *pushNotifications) publishToAPI(ctx context.Context, method, path string, bodyRequestBytes []byte) (_ PublishResult, err error) {
+	start := time.Now()
+	ctx, endSpan := pn.startSpan(ctx, "publish")
+	ctx = context.WithValue(ctx, publishMethodKey{}, method)
+	var statusCode int
+	defer func() {
+		endSpan(statusCode, err)
+		if pn.metrics != nil {
+			pn.metrics.ObservePublish(time.Since(start), statusCode, err)
+		}
+	}()
+
+	if pn.deliveryPacer != nil {
+		if err := pn.deliveryPacer.wait(ctx); err != nil {
+			return PublishResult{}, errors.Wrap(err, "Failed to publish notifications while waiting for the delivery rate")
+		}
+	}
+
+	httpReq, err := pn.newRequest(ctx, http.MethodPost, pn.endpointURL(path), bodyRequestBytes)
 	if err != nil {
-		return "", errors.Wrap(err, "Failed to publish notifications due to a network error")
+		return PublishResult{}, errors.Wrap(err, "Failed to prepare the publish request")
 	}
 
-	defer httpResp.Body.Close()
-	responseBytes, err := ioutil.ReadAll(httpResp.Body)
+	networkStart := time.Now()
+	httpResp, responseBytes, err := pn.do(httpReq)
+	if err == nil && httpResp.StatusCode == http.StatusUnauthorized && pn.fallbackSecretKey != "" {
+		pn.logger.Warnf("Publish was unauthorized with the Secret Key, retrying with the fallback Secret Key")
+
+		httpReq, err = pn.newRequest(ctx, http.MethodPost, pn.endpointURL(path), bodyRequestBytes)
+		if err != nil {
+			return PublishResult{}, errors.Wrap(err, "Failed to prepare the publish request")
+		}
+		httpReq.Header.Set("Authorization", pn.authScheme+" "+pn.fallbackSecretKey)
+
+		httpResp, responseBytes, err = pn.do(httpReq)
+	}
+	networkDuration := time.Since(networkStart)
+	if httpResp != nil {
+		statusCode = httpResp.StatusCode
+	}
 	if err != nil {
-		return "", errors.Wrap(err, "Failed to read publish notification response due to a network error")
+		if ctx.Err() != nil {
+			return PublishResult{}, errors.Wrap(ctx.Err(), "Failed to publish notifications because the context was cancelled or timed out")
+		}
+		if httpResp != nil {
+			return PublishResult{}, errors.Wrap(err, "Failed to read publish notification response due to a network error")
+		}
+		return PublishResult{}, errors.Wrap(err, "Failed to publish notifications due to a network error")
 	}
 
 	switch httpResp.StatusCode {
@@ -228,56 +706,98 @@ func (pn *pushNotifications) publishToAPI(url string, bodyRequestBytes []byte) (
 		pubResponse := &publishResponse{}
 		err = json.Unmarshal(responseBytes, pubResponse)
 		if err != nil {
-			return "", errors.Wrap(err, "Failed to read publish notification response due to invalid JSON")
+			return PublishResult{}, errors.Wrap(err, "Failed to read publish notification response due to invalid JSON")
 		}
+		if pubResponse.PublishId == "" && pn.requireNonEmptyPublishId {
+			return PublishResult{}, errors.New("Failed to publish notification: the response did not contain a publish id")
+		}
+
+		result := PublishResult{
+			PublishId:     pubResponse.PublishId,
+			RequestId:     httpResp.Header.Get(requestIdHeader),
+			Endpoint:      pn.baseEndpoint.String(),
+			RequestBytes:  len(bodyRequestBytes),
+			ResponseBytes: len(responseBytes),
+			RateLimit:     parseRateLimit(httpResp.Header),
 
-		return pubResponse.PublishId, nil
+			NetworkDuration: networkDuration,
+		}
+		if httpResp.TLS != nil {
+			result.TLSVersion = httpResp.TLS.Version
+			result.TLSCipherSuite = httpResp.TLS.CipherSuite
+		}
+		return result, nil
+	case http.StatusNotFound:
+		// Almost always a wrong or disabled instance id, which may come back
+		// without a JSON body from the API's edge.
+		apiError := &APIError{StatusCode: httpResp.StatusCode, RequestId: httpResp.Header.Get(requestIdHeader)}
+		pubErrorResponse := &errorResponse{}
+		if json.Unmarshal(responseBytes, pubErrorResponse) == nil {
+			apiError.Code = pubErrorResponse.Error
+			apiError.Description = pubErrorResponse.Description
+		}
+
+		return PublishResult{}, errors.Wrapf(apiError,
+			"Failed to publish notification: Instance %s not found (404): verify your instance id",
+			redact(pn.InstanceId))
 	default:
 		pubErrorResponse := &errorResponse{}
 		err = json.Unmarshal(responseBytes, pubErrorResponse)
 		if err != nil {
-			return "", errors.Wrap(err, "Failed to read publish notification response due to invalid JSON")
+			return PublishResult{}, errors.Wrap(err, "Failed to read publish notification response due to invalid JSON")
 		}
 
-		errorMessage := fmt.Sprintf("%s: %s", pubErrorResponse.Error, pubErrorResponse.Description)
-		return "", errors.Wrap(errors.New(errorMessage), "Failed to publish notification")
+		apiError := &APIError{
+			StatusCode:  httpResp.StatusCode,
+			Code:        pubErrorResponse.Error,
+			Description: pubErrorResponse.Description,
+			RequestId:   httpResp.Header.Get(requestIdHeader),
+		}
+		return PublishResult{}, errors.Wrap(apiError, "Failed to publish notification")
 	}
 }
 
 func (pn *pushNotifications) DeleteUser(userId string) error {
-	if len(userId) == 0 {
-		return errors.New("User Id cannot be empty")
-	}
+	return pn.DeleteUserWithContext(context.Background(), userId)
+}
 
-	if len(userId) > maxUserIdLength {
-		return errors.Errorf(
-			"User Id ('%s') length too long (expected fewer than %d characters, got %d)",
-			userId, maxUserIdLength+1, len(userId))
-	}
+func (pn *pushNotifications) DeleteUserWithContext(ctx context.Context, userId string) (err error) {
+	defer func() {
+		pn.emitEvent(EventDeleteUser, "DeleteUser", func() string { return summariseTargets("users", []string{userId}) }, err)
+	}()
 
-	if !utf8.ValidString(userId) {
-		return errors.New("User Id must be encoded using utf8")
+	if rule, err := userIdError(userId); err != nil {
+		return pn.validationFailed(rule, userId, err)
 	}
 
-	URL := fmt.Sprintf("%s/customer_api/v1/instances/%s/users/%s", pn.baseEndpoint, pn.InstanceId, url.PathEscape(userId))
-	httpReq, err := http.NewRequest(http.MethodDelete, URL, nil)
+	start := time.Now()
+	ctx, endSpan := pn.startSpan(ctx, "delete_user")
+	var statusCode int
+	defer func() {
+		endSpan(statusCode, err)
+		if pn.metrics != nil {
+			pn.metrics.ObserveDeleteUser(time.Since(start), statusCode, err)
+		}
+	}()
+
+	path := fmt.Sprintf("/customer_api/v1/instances/%s/users/%s", pn.InstanceId, url.PathEscape(userId))
+	httpReq, err := pn.newRequest(ctx, http.MethodDelete, pn.endpointURL(path), nil)
 	if err != nil {
 		return errors.Wrap(err, "Failed to prepare the delete user request")
 	}
 
-	httpReq.Header.Add("Authorization", "Bearer "+pn.SecretKey)
-	httpReq.Header.Add("Content-Type", "application/json")
-	httpReq.Header.Add("X-Pusher-Library", "pusher-push-notifications-go "+sdkVersion)
-
-	httpResp, err := pn.httpClient.Do(httpReq)
-	if err != nil {
-		return errors.Wrap(err, "Failed to delete user due to a network error")
+	httpResp, responseBytes, err := pn.do(httpReq)
+	if httpResp != nil {
+		statusCode = httpResp.StatusCode
 	}
-
-	defer httpResp.Body.Close()
-	responseBytes, err := ioutil.ReadAll(httpResp.Body)
 	if err != nil {
-		return errors.Wrap(err, "Failed to read delete user response due to a network error")
+		if ctx.Err() != nil {
+			return errors.Wrap(ctx.Err(), "Failed to delete user because the context was cancelled or timed out")
+		}
+		if httpResp != nil {
+			return errors.Wrap(err, "Failed to read delete user response due to a network error")
+		}
+		return errors.Wrap(err, "Failed to delete user due to a network error")
 	}
 
 	switch httpResp.StatusCode {
@@ -290,9 +810,160 @@ func (pn *pushNotifications) DeleteUser(userId string) error {
 			return errors.Wrap(err, "Failed to read delete user response due to invalid JSON")
 		}
 
-		errorMessage := fmt.Sprintf("%s: %s", errResponse.Error, errResponse.Description)
-		return errors.Wrap(errors.New(errorMessage), "Failed to delete user")
+		apiError := &APIError{
+			StatusCode:  httpResp.StatusCode,
+			Code:        errResponse.Error,
+			Description: errResponse.Description,
+			RequestId:   httpResp.Header.Get(requestIdHeader),
+		}
+		return errors.Wrap(apiError, "Failed to delete user")
+	}
+}
+
+// Reports whether `secretKey` can be sent in a header: valid utf8 without control characters.
+func validSecretKey(secretKey string) bool {
+	return utf8.ValidString(secretKey) && strings.IndexFunc(secretKey, unicode.IsControl) == -1
+}
+
+// Builds the URL of `escapedPath`, relative to the base endpoint, without
+// parsing the base endpoint again.
+func (pn *pushNotifications) endpointURL(escapedPath string) *url.URL {
+	endpoint := *pn.baseEndpoint
+	endpoint.RawPath = strings.TrimSuffix(pn.baseEndpoint.EscapedPath(), "/") + escapedPath
+	endpoint.Path, _ = url.PathUnescape(endpoint.RawPath)
+	return &endpoint
+}
+
+// Builds a request to the Beams API with the headers every call needs.
+func (pn *pushNotifications) newRequest(ctx context.Context, method string, endpoint *url.URL, body []byte) (*http.Request, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
 	}
 
-	return nil
+	ctx = httptrace.WithClientTrace(ctx, pn.stats.connectionTrace())
+	if pn.clientTrace != nil {
+		if trace := pn.clientTrace(ctx); trace != nil {
+			ctx = httptrace.WithClientTrace(ctx, trace)
+		}
+	}
+
+	// The URL is set directly, as it has already been built.
+	httpReq, err := http.NewRequestWithContext(ctx, method, "", bodyReader)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.URL = endpoint
+	httpReq.Host = endpoint.Host
+
+	httpReq.Header.Add("Authorization", pn.authScheme+" "+pn.SecretKey)
+	httpReq.Header.Add("Content-Type", "application/json")
+	library := "pusher-push-notifications-go " + sdkVersion
+	if pn.librarySuffix != "" {
+		library += "; " + pn.librarySuffix
+	}
+	httpReq.Header.Add("X-Pusher-Library", library)
+	for key, values := range pn.extraHeaders {
+		for _, value := range values {
+			httpReq.Header.Add(key, value)
+		}
+	}
+
+	if pn.contextRequestIdKey != nil {
+		if requestId := contextRequestId(ctx, pn.contextRequestIdKey); requestId != "" {
+			httpReq.Header.Set(pn.contextRequestIdHeader, requestId)
+		}
+	}
+
+	return httpReq, nil
+}
+
+// Reads the request id stored in `ctx` under `key`, if any.
+func contextRequestId(ctx context.Context, key interface{}) string {
+	switch requestId := ctx.Value(key).(type) {
+	case string:
+		return requestId
+	case fmt.Stringer:
+		return requestId.String()
+	default:
+		return ""
+	}
+}
+
+// Sends `httpReq` and reads the whole response body, retrying network errors
+// and 5xx responses as configured with `WithRetries`.
+// A non-nil response alongside a non-nil error means the body could not be read.
+func (pn *pushNotifications) do(httpReq *http.Request) (*http.Response, []byte, error) {
+	ctx := httpReq.Context()
+	for attempt := 1; ; attempt++ {
+		httpResp, responseBytes, err := pn.doAttemptWithTimeout(httpReq)
+		if attempt >= pn.maxAttempts || !pn.shouldRetry(httpResp, responseBytes, err) || ctx.Err() != nil {
+			return httpResp, responseBytes, err
+		}
+
+		// Stop waiting as soon as the caller gives up.
+		backoff := time.NewTimer(pn.backoffStrategy().Delay(attempt))
+		select {
+		case <-backoff.C:
+		case <-ctx.Done():
+			backoff.Stop()
+			return nil, nil, ctx.Err()
+		}
+
+		if httpReq.GetBody != nil {
+			body, err := httpReq.GetBody()
+			if err != nil {
+				return nil, nil, err
+			}
+			httpReq.Body = body
+		}
+	}
+}
+
+// Makes an attempt bounded by the per-attempt timeout, if one is set.
+func (pn *pushNotifications) doAttemptWithTimeout(httpReq *http.Request) (*http.Response, []byte, error) {
+	if pn.perAttemptTimeout <= 0 {
+		return pn.doAttempt(httpReq)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(httpReq.Context(), pn.perAttemptTimeout)
+	defer cancel()
+	return pn.doAttempt(httpReq.WithContext(attemptCtx))
+}
+
+func (pn *pushNotifications) doAttempt(httpReq *http.Request) (*http.Response, []byte, error) {
+	if pn.concurrencySemaphore != nil {
+		select {
+		case pn.concurrencySemaphore <- struct{}{}:
+			defer func() { <-pn.concurrencySemaphore }()
+		case <-httpReq.Context().Done():
+			return nil, nil, httpReq.Context().Err()
+		}
+	}
+
+	// Tells whether a timeout happened before or after connecting.
+	var connected int32
+	httpReq = httpReq.WithContext(httptrace.WithClientTrace(httpReq.Context(), &httptrace.ClientTrace{
+		GotConn: func(httptrace.GotConnInfo) { atomic.StoreInt32(&connected, 1) },
+	}))
+
+	httpResp, err := pn.httpClient.Do(httpReq)
+	if err != nil {
+		pn.stats.recordAttempt(int(httpReq.ContentLength), 0)
+		pn.logAttempt(httpReq, nil, nil, err)
+		return nil, nil, asTimeoutError(err, atomic.LoadInt32(&connected) == 1)
+	}
+
+	defer httpResp.Body.Close()
+	if pn.responseInspector != nil {
+		pn.responseInspector(httpResp)
+	}
+	responseBytes, err := ioutil.ReadAll(httpResp.Body)
+	pn.stats.recordAttempt(int(httpReq.ContentLength), len(responseBytes))
+	pn.logAttempt(httpReq, httpResp, responseBytes, err)
+	if err != nil {
+		return httpResp, nil, asTimeoutError(err, true)
+	}
+
+	return httpResp, responseBytes, nil
 }
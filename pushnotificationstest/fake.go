@@ -0,0 +1,355 @@
+// Package pushnotificationstest provides a fake of the Beams client, for unit
+// testing code that publishes notifications without an HTTP server.
+package pushnotificationstest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	pushnotifications "github.com/pusher/push-notifications-go"
+)
+
+// A publish made through a `FakeClient`.
+type Publish struct {
+	// The interests published to, or nil for a publish to users.
+	Interests []string
+	// The user ids published to, or nil for a publish to interests.
+	Users []string
+	// The request published, or nil for a raw publish.
+	Request map[string]interface{}
+	// The payload of a raw publish, or nil.
+	Payload json.RawMessage
+	// The publish id returned, or empty if the publish failed.
+	PublishId string
+	// The error returned, if any.
+	Err error
+}
+
+// A fake `pushnotifications.PushNotifications` that records the calls made to
+// it instead of sending anything to the Beams API.
+//
+// Interests and user ids are validated like the real client does, and invalid
+// ones fail without being recorded. Tokens are real JWTs, signed with a fixed
+// key, so `VerifyToken` accepts the tokens the fake generates.
+//
+// The exported fields set the outcome of calls. Set them before the fake is
+// used, or between calls, but not while calls are in flight.
+type FakeClient struct {
+	// The publish ids returned by successful publishes, in order. Once used
+	// up, publish ids are generated: "fake-publish-1", "fake-publish-2", etc.
+	PublishIds []string
+	// Returned by every publish, if set, instead of a publish id.
+	PublishErr error
+	// Returned by every user deletion, if set.
+	DeleteUserErr error
+	// Returned by every token generation, if set, instead of a token.
+	TokenErr error
+	// Makes `PublishToInterestsBatched` carry on past failed chunks, like
+	// `WithContinueOnBatchError`.
+	ContinueOnBatchError bool
+
+	tokens pushnotifications.PushNotifications
+
+	mu           sync.Mutex
+	publishCount int
+	publishes    []Publish
+	deletedUsers []string
+	tokenUserIds []string
+}
+
+// Compile-time check that the fake implements the whole interface.
+var _ pushnotifications.PushNotifications = (*FakeClient)(nil)
+
+const (
+	fakeInstanceId = "00000000-0000-0000-0000-000000000000"
+	fakeSecretKey  = "FAKE0000000000000000000000000000"
+)
+
+// Creates a `FakeClient` with nothing recorded.
+func NewFakeClient() *FakeClient {
+	tokens, err := pushnotifications.New(fakeInstanceId, fakeSecretKey, pushnotifications.WithTestMode())
+	if err != nil {
+		panic(err)
+	}
+	return &FakeClient{tokens: tokens}
+}
+
+// Returns every publish recorded so far, in order.
+func (f *FakeClient) Publishes() []Publish {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Publish(nil), f.publishes...)
+}
+
+// Returns the user id of every user deletion recorded so far, in order.
+func (f *FakeClient) DeletedUsers() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.deletedUsers...)
+}
+
+// Returns the user id of every token generated so far, in order.
+func (f *FakeClient) TokenUserIds() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.tokenUserIds...)
+}
+
+// Forgets every call recorded so far. The canned outcomes are kept.
+func (f *FakeClient) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.publishCount = 0
+	f.publishes = nil
+	f.deletedUsers = nil
+	f.tokenUserIds = nil
+}
+
+func (f *FakeClient) PublishToInterests(interests []string, request map[string]interface{}) (string, error) {
+	return f.PublishToInterestsWithContext(context.Background(), interests, request)
+}
+
+func (f *FakeClient) PublishToInterestsWithContext(ctx context.Context, interests []string, request map[string]interface{}) (string, error) {
+	result, err := f.publishToInterests(ctx, interests, request, nil)
+	return result.PublishId, err
+}
+
+func (f *FakeClient) PublishToInterestsWithResult(interests []string, request map[string]interface{}) (pushnotifications.PublishResult, error) {
+	return f.publishToInterests(context.Background(), interests, request, nil)
+}
+
+func (f *FakeClient) PublishToInterestsAsync(ctx context.Context, interests []string, request map[string]interface{}) *pushnotifications.PublishFuture {
+	return pushnotifications.NewPublishFuture(ctx, func(ctx context.Context) (pushnotifications.PublishResult, error) {
+		return f.publishToInterests(ctx, interests, request, nil)
+	})
+}
+
+func (f *FakeClient) PublishRawToInterests(interests []string, payload json.RawMessage) (string, error) {
+	result, err := f.publishToInterests(context.Background(), interests, nil, payload)
+	return result.PublishId, err
+}
+
+func (f *FakeClient) PublishToInterestsRawPayload(interests []string, payload json.RawMessage) (string, error) {
+	return f.PublishRawToInterests(interests, payload)
+}
+
+func (f *FakeClient) Publish(interests []string, request map[string]interface{}) (string, error) {
+	return f.PublishToInterests(interests, request)
+}
+
+func (f *FakeClient) PublishToUsers(users []string, request map[string]interface{}) (string, error) {
+	return f.PublishToUsersWithContext(context.Background(), users, request)
+}
+
+func (f *FakeClient) PublishToUsersWithContext(ctx context.Context, users []string, request map[string]interface{}) (string, error) {
+	result, err := f.publishToUsers(ctx, users, request, nil)
+	return result.PublishId, err
+}
+
+func (f *FakeClient) PublishRawToUsers(users []string, payload json.RawMessage) (string, error) {
+	result, err := f.publishToUsers(context.Background(), users, nil, payload)
+	return result.PublishId, err
+}
+
+func (f *FakeClient) PublishToInterestsBatched(interests []string, request map[string]interface{}) ([]string, error) {
+	if len(interests) == 0 {
+		return nil, errors.Wrap(pushnotifications.ErrNoInterests, "No interests were supplied")
+	}
+
+	return pushnotifications.PublishInterestsInChunks(interests, pushnotifications.MaxInterestsPerPublish, f.ContinueOnBatchError,
+		func(chunk []string) (pushnotifications.PublishResult, error) {
+			return f.publishToInterests(context.Background(), chunk, request, nil)
+		})
+}
+
+func (f *FakeClient) PublishToUsersBatched(users []string, request map[string]interface{}) (pushnotifications.BatchSummary, error) {
+	if len(users) == 0 {
+		return pushnotifications.BatchSummary{}, errors.Wrap(pushnotifications.ErrNoUsers, "Must supply at least one user id")
+	}
+
+	return pushnotifications.PublishUsersInChunks(users, pushnotifications.MaxUsersPerPublish,
+		func(chunk []string) (pushnotifications.PublishResult, error) {
+			return f.publishToUsers(context.Background(), chunk, request, nil)
+		})
+}
+
+func (f *FakeClient) GenerateToken(userId string) (map[string]interface{}, error) {
+	beamsToken, err := f.GenerateBeamsToken(userId)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"token": beamsToken.Token}, nil
+}
+
+func (f *FakeClient) GenerateBeamsToken(userId string) (pushnotifications.BeamsToken, error) {
+	if err := f.recordToken(userId); err != nil {
+		return pushnotifications.BeamsToken{}, err
+	}
+	return f.tokens.GenerateBeamsToken(userId)
+}
+
+func (f *FakeClient) GenerateTokenWithClaimsResult(userId string) (string, jwt.MapClaims, error) {
+	if err := f.recordToken(userId); err != nil {
+		return "", nil, err
+	}
+	return f.tokens.GenerateTokenWithClaimsResult(userId)
+}
+
+func (f *FakeClient) VerifyToken(token string) (string, error) {
+	return f.tokens.VerifyToken(token)
+}
+
+func (f *FakeClient) GenerateTokensConcurrent(ctx context.Context, userIds []string, concurrency int) (map[string]string, map[string]error) {
+	tokens := make(map[string]string, len(userIds))
+	tokenErrors := map[string]error{}
+	for _, userId := range userIds {
+		if ctx.Err() != nil {
+			tokenErrors[userId] = ctx.Err()
+			continue
+		}
+
+		token, _, err := f.GenerateTokenWithClaimsResult(userId)
+		if err != nil {
+			tokenErrors[userId] = err
+		} else {
+			tokens[userId] = token
+		}
+	}
+	return tokens, tokenErrors
+}
+
+func (f *FakeClient) NewBatcher(workers int) *pushnotifications.Batcher {
+	return pushnotifications.NewBatcherFuncs(pushnotifications.BatcherFuncs{
+		PublishToInterests: func(ctx context.Context, interests []string, request map[string]interface{}) (pushnotifications.PublishResult, error) {
+			return f.publishToInterests(ctx, interests, request, nil)
+		},
+		PublishToUsers: func(ctx context.Context, users []string, request map[string]interface{}) (pushnotifications.PublishResult, error) {
+			return f.publishToUsers(ctx, users, request, nil)
+		},
+		DeleteUser: f.DeleteUserWithContext,
+	}, workers)
+}
+
+func (f *FakeClient) DeleteUser(userId string) error {
+	return f.DeleteUserWithContext(context.Background(), userId)
+}
+
+func (f *FakeClient) DeleteUserWithContext(ctx context.Context, userId string) error {
+	if err := pushnotifications.ValidateUserId(userId); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "Failed to delete user")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deletedUsers = append(f.deletedUsers, userId)
+	return f.DeleteUserErr
+}
+
+// Counts the publishes and user deletions recorded as requests. The sizes are
+// always 0, as nothing is sent.
+func (f *FakeClient) Stats() pushnotifications.Stats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return pushnotifications.Stats{Requests: uint64(len(f.publishes) + len(f.deletedUsers))}
+}
+
+// Returns nil, as the fake makes no HTTP requests. Use `Publishes` instead.
+func (f *FakeClient) RecordedRequests() []pushnotifications.RecordedRequest {
+	return nil
+}
+
+func (f *FakeClient) publishToInterests(ctx context.Context, interests []string, request map[string]interface{}, payload json.RawMessage) (pushnotifications.PublishResult, error) {
+	if len(interests) == 0 {
+		return pushnotifications.PublishResult{}, errors.Wrap(pushnotifications.ErrNoInterests, "No interests were supplied")
+	}
+	if len(interests) > pushnotifications.MaxInterestsPerPublish {
+		return pushnotifications.PublishResult{}, errors.Wrapf(pushnotifications.ErrTooManyInterests,
+			"Too many interests supplied (%d): API only supports up to %d", len(interests), pushnotifications.MaxInterestsPerPublish)
+	}
+	for _, interest := range interests {
+		if err := pushnotifications.ValidateInterest(interest); err != nil {
+			return pushnotifications.PublishResult{}, err
+		}
+	}
+
+	return f.publish(ctx, Publish{
+		Interests: append([]string(nil), interests...),
+		Request:   copyRequest(request),
+		Payload:   payload,
+	})
+}
+
+func (f *FakeClient) publishToUsers(ctx context.Context, users []string, request map[string]interface{}, payload json.RawMessage) (pushnotifications.PublishResult, error) {
+	if len(users) == 0 {
+		return pushnotifications.PublishResult{}, errors.Wrap(pushnotifications.ErrNoUsers, "Must supply at least one user id")
+	}
+	if len(users) > pushnotifications.MaxUsersPerPublish {
+		return pushnotifications.PublishResult{}, errors.Wrapf(pushnotifications.ErrTooManyUsers,
+			"Too many user ids supplied. API supports up to %d, got %d", pushnotifications.MaxUsersPerPublish, len(users))
+	}
+	for _, userId := range users {
+		if err := pushnotifications.ValidateUserId(userId); err != nil {
+			return pushnotifications.PublishResult{}, err
+		}
+	}
+
+	return f.publish(ctx, Publish{
+		Users:   append([]string(nil), users...),
+		Request: copyRequest(request),
+		Payload: payload,
+	})
+}
+
+// Records `publish` and returns its canned outcome.
+func (f *FakeClient) publish(ctx context.Context, publish Publish) (pushnotifications.PublishResult, error) {
+	if err := ctx.Err(); err != nil {
+		return pushnotifications.PublishResult{}, errors.Wrap(err, "Failed to publish")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.publishCount++
+	if f.PublishErr != nil {
+		publish.Err = f.PublishErr
+	} else if len(f.PublishIds) > 0 {
+		publish.PublishId = f.PublishIds[0]
+		f.PublishIds = f.PublishIds[1:]
+	} else {
+		publish.PublishId = fmt.Sprintf("fake-publish-%d", f.publishCount)
+	}
+	f.publishes = append(f.publishes, publish)
+
+	return pushnotifications.PublishResult{PublishId: publish.PublishId}, publish.Err
+}
+
+func (f *FakeClient) recordToken(userId string) error {
+	if err := pushnotifications.ValidateUserId(userId); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tokenUserIds = append(f.tokenUserIds, userId)
+	return f.TokenErr
+}
+
+// Copies the top level of `request`, so that the recorded request isn't
+// changed by the caller reusing its map.
+func copyRequest(request map[string]interface{}) map[string]interface{} {
+	if request == nil {
+		return nil
+	}
+	copied := make(map[string]interface{}, len(request))
+	for key, value := range request {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,159 @@
+package pushnotificationstest
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	pushnotifications "github.com/pusher/push-notifications-go"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var testPublishRequest = map[string]interface{}{
+	"fcm": map[string]interface{}{
+		"notification": map[string]interface{}{
+			"title": "Hello",
+			"body":  "Hello, world",
+		},
+	},
+}
+
+func TestFakeClient(t *testing.T) {
+	Convey("A fake client", t, func() {
+		fake := NewFakeClient()
+
+		Convey("should record publishes and return generated publish ids", func() {
+			publishId, err := fake.PublishToInterests([]string{"hello"}, testPublishRequest)
+			So(err, ShouldBeNil)
+			So(publishId, ShouldEqual, "fake-publish-1")
+
+			publishId, err = fake.PublishToUsers([]string{"u-123"}, testPublishRequest)
+			So(err, ShouldBeNil)
+			So(publishId, ShouldEqual, "fake-publish-2")
+
+			So(fake.Publishes(), ShouldResemble, []Publish{
+				{Interests: []string{"hello"}, Request: testPublishRequest, PublishId: "fake-publish-1"},
+				{Users: []string{"u-123"}, Request: testPublishRequest, PublishId: "fake-publish-2"},
+			})
+			So(fake.Stats().Requests, ShouldEqual, 2)
+		})
+
+		Convey("should record raw publishes", func() {
+			payload := json.RawMessage(`{"web":{"notification":{"title":"Hi"}}}`)
+			_, err := fake.PublishRawToInterests([]string{"hello"}, payload)
+			So(err, ShouldBeNil)
+			So(fake.Publishes()[0].Payload, ShouldResemble, payload)
+			So(fake.Publishes()[0].Request, ShouldBeNil)
+		})
+
+		Convey("should return canned publish ids in order", func() {
+			fake.PublishIds = []string{"pub-a", "pub-b"}
+
+			for _, expected := range []string{"pub-a", "pub-b", "fake-publish-3"} {
+				publishId, err := fake.PublishToInterests([]string{"hello"}, testPublishRequest)
+				So(err, ShouldBeNil)
+				So(publishId, ShouldEqual, expected)
+			}
+		})
+
+		Convey("should return a canned publish error", func() {
+			fake.PublishErr = errors.New("boom")
+
+			publishId, err := fake.PublishToInterests([]string{"hello"}, testPublishRequest)
+			So(err, ShouldEqual, fake.PublishErr)
+			So(publishId, ShouldBeEmpty)
+			So(fake.Publishes()[0].Err, ShouldEqual, fake.PublishErr)
+		})
+
+		Convey("should reject invalid interests and user ids without recording them", func() {
+			_, err := fake.PublishToInterests([]string{"not valid"}, testPublishRequest)
+			So(errors.Is(err, pushnotifications.ErrInvalidInterestName), ShouldBeTrue)
+			_, err = fake.PublishToUsers(nil, testPublishRequest)
+			So(errors.Is(err, pushnotifications.ErrNoUsers), ShouldBeTrue)
+			So(fake.Publishes(), ShouldBeEmpty)
+		})
+
+		Convey("should fail publishes once the context is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			_, err := fake.PublishToInterestsWithContext(ctx, []string{"hello"}, testPublishRequest)
+			So(errors.Is(err, context.Canceled), ShouldBeTrue)
+		})
+
+		Convey("should publish asynchronously and on a batcher", func() {
+			result, err := fake.PublishToInterestsAsync(context.Background(), []string{"hello"}, testPublishRequest).Result()
+			So(err, ShouldBeNil)
+			So(result.PublishId, ShouldEqual, "fake-publish-1")
+
+			batcher := fake.NewBatcher(2)
+			batcher.PublishToUsers(context.Background(), []string{"u-123"}, testPublishRequest)
+			batcher.DeleteUser(context.Background(), "u-456")
+			batcher.Wait()
+
+			So(fake.Publishes(), ShouldHaveLength, 2)
+			So(fake.DeletedUsers(), ShouldResemble, []string{"u-456"})
+		})
+
+		Convey("should publish batches in chunks", func() {
+			interests := make([]string, 150)
+			for i := range interests {
+				interests[i] = "hello"
+			}
+
+			publishIds, err := fake.PublishToInterestsBatched(interests, testPublishRequest)
+			So(err, ShouldBeNil)
+			So(publishIds, ShouldResemble, []string{"fake-publish-1", "fake-publish-2"})
+			So(fake.Publishes()[0].Interests, ShouldHaveLength, pushnotifications.MaxInterestsPerPublish)
+			So(fake.Publishes()[1].Interests, ShouldHaveLength, 50)
+
+			Convey("carrying on past failed chunks if set", func() {
+				fake.Reset()
+				fake.PublishErr = errors.New("boom")
+				fake.ContinueOnBatchError = true
+
+				_, err := fake.PublishToInterestsBatched(interests, testPublishRequest)
+				var batchErr *pushnotifications.BatchError
+				So(errors.As(err, &batchErr), ShouldBeTrue)
+				So(batchErr.Chunks, ShouldEqual, 2)
+				So(batchErr.Errors, ShouldHaveLength, 2)
+				So(fake.Publishes(), ShouldHaveLength, 2)
+			})
+		})
+
+		Convey("should record user deletions and return a canned error", func() {
+			So(fake.DeleteUser("u-123"), ShouldBeNil)
+			fake.DeleteUserErr = errors.New("boom")
+			So(fake.DeleteUser("u-456"), ShouldEqual, fake.DeleteUserErr)
+			So(fake.DeletedUsers(), ShouldResemble, []string{"u-123", "u-456"})
+		})
+
+		Convey("should generate tokens it can verify", func() {
+			token, err := fake.GenerateBeamsToken("u-123")
+			So(err, ShouldBeNil)
+
+			userId, err := fake.VerifyToken(token.Token)
+			So(err, ShouldBeNil)
+			So(userId, ShouldEqual, "u-123")
+			So(fake.TokenUserIds(), ShouldResemble, []string{"u-123"})
+
+			Convey("unless a token error is set", func() {
+				fake.TokenErr = errors.New("boom")
+				_, err := fake.GenerateToken("u-456")
+				So(err, ShouldEqual, fake.TokenErr)
+			})
+		})
+
+		Convey("should forget recorded calls when reset", func() {
+			fake.PublishToInterests([]string{"hello"}, testPublishRequest)
+			fake.DeleteUser("u-123")
+			fake.GenerateToken("u-123")
+			fake.Reset()
+
+			So(fake.Publishes(), ShouldBeEmpty)
+			So(fake.DeletedUsers(), ShouldBeEmpty)
+			So(fake.TokenUserIds(), ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,90 @@
+package pushnotifications
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func (pn *pushNotifications) PublishRawToInterests(interests []string, payload json.RawMessage) (string, error) {
+	result, err := pn.publishRaw(context.Background(), "PublishRawToInterests", "interests", interests, payload)
+	return result.PublishId, err
+}
+
+// Deprecated: Use PublishRawToInterests instead
+func (pn *pushNotifications) PublishToInterestsRawPayload(interests []string, payload json.RawMessage) (string, error) {
+	if pn.deprecatedMethodsDisabled {
+		return "", errors.New("PublishToInterestsRawPayload is deprecated and has been disabled: use PublishRawToInterests instead")
+	}
+	return pn.PublishRawToInterests(interests, payload)
+}
+
+func (pn *pushNotifications) PublishRawToUsers(users []string, payload json.RawMessage) (string, error) {
+	result, err := pn.publishRaw(context.Background(), "PublishRawToUsers", "users", users, payload)
+	return result.PublishId, err
+}
+
+// Publishes `payload`, a JSON object, to the `targets` under `targetKey`:
+// either `interests` or `users`.
+func (pn *pushNotifications) publishRaw(ctx context.Context, method, targetKey string, targets []string, payload json.RawMessage) (result PublishResult, err error) {
+	defer func() {
+		pn.emitEvent(EventPublish, method, func() string { return summariseTargets(targetKey, targets) }, err)
+	}()
+	validationStart := time.Now()
+
+	var path string
+	if targetKey == "interests" {
+		targets = pn.sortAndDeduplicate(pn.applyInterestPrefix(targets))
+		err = pn.validateInterests(targets)
+		path = fmt.Sprintf("/publish_api/v1/instances/%s/publishes", pn.InstanceId)
+	} else {
+		err = pn.validateUsers(targets)
+		path = fmt.Sprintf("/publish_api/v1/instances/%s/publishes/users", pn.InstanceId)
+	}
+	if err != nil {
+		return PublishResult{}, err
+	}
+
+	// Only the top level is decoded, unless the depth has to be checked.
+	var topLevel map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &topLevel); err != nil || topLevel == nil {
+		return PublishResult{}, errors.New("Publish request payload must be a JSON object")
+	}
+	if pn.payloadEnvelopeKey == "" {
+		if _, ok := topLevel[targetKey]; ok {
+			return PublishResult{}, errors.Errorf("Publish request payload must not contain `%s`", targetKey)
+		}
+	}
+	hasKey := func(key string) bool {
+		_, ok := topLevel[key]
+		return ok
+	}
+	if err := pn.validatePlatforms(hasKey, len(topLevel)); err != nil {
+		return PublishResult{}, err
+	}
+	if pn.maxPayloadDepth > 0 {
+		var request map[string]interface{}
+		if err := json.Unmarshal(payload, &request); err != nil {
+			return PublishResult{}, errors.New("Publish request payload must be a JSON object")
+		}
+		if err := pn.validateDepth(request); err != nil {
+			return PublishResult{}, err
+		}
+	}
+
+	bodyRequestBytes, err := pn.addPublishTargets(payload, targetKey, targets)
+	if err != nil {
+		return PublishResult{}, err
+	}
+	validationDuration := time.Since(validationStart)
+
+	result, err = pn.publishToAPI(ctx, method, path, bodyRequestBytes)
+	if err != nil {
+		return PublishResult{}, err
+	}
+	result.ValidationDuration = validationDuration
+	return result, nil
+}
@@ -0,0 +1,107 @@
+package pushnotifications
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPublishRaw(t *testing.T) {
+	Convey("A raw publish", t, func() {
+		var requestBody []byte
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestBody, _ = ioutil.ReadAll(r.Body)
+			w.Write([]byte(`{"publishId":"pub-123"}`))
+		}))
+		defer testServer.Close()
+
+		pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL))
+		So(err, ShouldBeNil)
+
+		Convey("should send the payload bytes unchanged, with the interests added", func() {
+			payload := json.RawMessage(`{ "fcm": {"notification": {"title": "Hello", "body": "Hi"}},
+				"apns": {"aps": {"alert": "Hi"}, "data": {"amount": 1.50}} }` + "\n")
+
+			publishId, err := pn.PublishRawToInterests([]string{"hello", "hi"}, payload)
+			So(err, ShouldBeNil)
+			So(publishId, ShouldEqual, "pub-123")
+			So(string(requestBody), ShouldEqual, `{ "fcm": {"notification": {"title": "Hello", "body": "Hi"}},
+				"apns": {"aps": {"alert": "Hi"}, "data": {"amount": 1.50}} ,"interests":["hello","hi"]}`)
+			So(json.Valid(requestBody), ShouldBeTrue)
+		})
+
+		Convey("should publish with the deprecated `PublishToInterestsRawPayload` alias", func() {
+			publishId, err := pn.PublishToInterestsRawPayload([]string{"hello"}, json.RawMessage(`{"fcm":{"data":{}}}`))
+			So(err, ShouldBeNil)
+			So(publishId, ShouldEqual, "pub-123")
+			So(string(requestBody), ShouldEqual, `{"fcm":{"data":{}},"interests":["hello"]}`)
+		})
+
+		Convey("should not publish a payload without a platform", func() {
+			_, err := pn.PublishRawToInterests([]string{"hello"}, json.RawMessage(`{ }`))
+			So(errors.Is(err, ErrNoPlatforms), ShouldBeTrue)
+			So(requestBody, ShouldBeNil)
+		})
+
+		Convey("should check the depth limit set with `WithMaxPayloadDepth`", func() {
+			pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL), WithMaxPayloadDepth(3))
+			So(err, ShouldBeNil)
+
+			_, err = pn.PublishRawToInterests([]string{"hello"}, json.RawMessage(`{"apns":{"aps":{"alert":"Hi"}}}`))
+			So(err, ShouldBeNil)
+			_, err = pn.PublishRawToInterests([]string{"hello"}, json.RawMessage(`{"apns":{"aps":{"alert":{"title":"Hi"}}}}`))
+			So(errors.Is(err, ErrPayloadTooDeep), ShouldBeTrue)
+		})
+
+		Convey("should wrap the payload when using a payload envelope key", func() {
+			pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL), WithPayloadEnvelopeKey("payload"))
+			So(err, ShouldBeNil)
+
+			_, err = pn.PublishRawToInterests([]string{"hello"}, json.RawMessage(`{"web":{"data":{}}}`))
+			So(err, ShouldBeNil)
+			So(string(requestBody), ShouldEqual, `{"interests":["hello"],"payload":{"web":{"data":{}}}}`)
+		})
+
+		Convey("should not publish a payload that is not a JSON object", func() {
+			for _, payload := range []string{``, `[]`, `null`, `"fcm"`, `{"fcm":`} {
+				_, err := pn.PublishRawToInterests([]string{"hello"}, json.RawMessage(payload))
+				So(err, ShouldNotBeNil)
+			}
+			So(requestBody, ShouldBeNil)
+		})
+
+		Convey("should not publish a payload that already has interests", func() {
+			_, err := pn.PublishRawToInterests([]string{"hello"}, json.RawMessage(`{"fcm":{},"interests":["hi"]}`))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "must not contain `interests`")
+			So(requestBody, ShouldBeNil)
+		})
+
+		Convey("should publish to users", func() {
+			publishId, err := pn.PublishRawToUsers([]string{"u-1", "u-2"}, json.RawMessage(`{"apns":{"aps":{"alert":"Hi"}}}`))
+			So(err, ShouldBeNil)
+			So(publishId, ShouldEqual, "pub-123")
+			So(string(requestBody), ShouldEqual, `{"apns":{"aps":{"alert":"Hi"}},"users":["u-1","u-2"]}`)
+
+			_, err = pn.PublishRawToUsers([]string{"u-1"}, json.RawMessage(`{"apns":{},"users":["u-2"]}`))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "must not contain `users`")
+		})
+
+		Convey("should validate the users", func() {
+			_, err := pn.PublishRawToUsers([]string{""}, json.RawMessage(`{"fcm":{}}`))
+			So(errors.Is(err, ErrInvalidUserId), ShouldBeTrue)
+		})
+
+		Convey("should validate the interests", func() {
+			_, err := pn.PublishRawToInterests([]string{}, json.RawMessage(`{"fcm":{}}`))
+			So(errors.Is(err, ErrNoInterests), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,74 @@
+package pushnotifications
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// The header carrying the id the Beams API assigned to a request.
+const requestIdHeader = "X-Request-Id"
+
+// Details about a successful publish.
+//
+// Beams accepts publishes to interests that have no subscribers without
+// reporting it, and the API doesn't expose how many devices each interest
+// matched, either in the publish response or through a follow-up call.
+// That means there's no way to tell which interests were empty from here.
+type PublishResult struct {
+	// The id Beams assigned to the publish.
+	PublishId string
+
+	// The id the Beams API assigned to the publish request, from the
+	// `X-Request-Id` response header. Quote it when contacting support.
+	RequestId string
+
+	// The base URL the publish was sent to.
+	Endpoint string
+
+	// The size of the request body sent, in bytes.
+	RequestBytes int
+	// The size of the response body received, in bytes.
+	ResponseBytes int
+
+	// The rate limit reported by the Beams API, if any.
+	RateLimit RateLimit
+
+	// The TLS version and cipher suite negotiated for the connection the
+	// publish was sent on, e.g. `tls.VersionTLS13`, or zero without TLS.
+	TLSVersion     uint16
+	TLSCipherSuite uint16
+
+	// How long the request took to validate and encode, and how long was
+	// then spent sending it to the Beams API, including any retries.
+	ValidationDuration time.Duration
+	NetworkDuration    time.Duration
+}
+
+// The rate limit state reported in the `X-RateLimit-*` headers of a response.
+// Fields are left zero when the corresponding header is missing or invalid.
+type RateLimit struct {
+	// The number of requests allowed in the current window.
+	Limit int
+	// The number of requests left in the current window.
+	Remaining int
+	// When the current window ends.
+	Reset time.Time
+}
+
+func parseRateLimit(header http.Header) RateLimit {
+	rateLimit := RateLimit{}
+	rateLimit.Limit, _ = strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	rateLimit.Remaining, _ = strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+
+	// Either a Unix timestamp, or a number of seconds from now.
+	if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		if reset < 1e9 {
+			rateLimit.Reset = time.Now().Add(time.Duration(reset) * time.Second)
+		} else {
+			rateLimit.Reset = time.Unix(reset, 0)
+		}
+	}
+
+	return rateLimit
+}
@@ -0,0 +1,250 @@
+package pushnotifications
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPublishResult(t *testing.T) {
+	Convey("A Push Notifications Instance publishing with a result", t, func() {
+		var serverRequestHandler http.HandlerFunc = func(w http.ResponseWriter, r *http.Request) {}
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			serverRequestHandler(w, r)
+		}))
+		defer testServer.Close()
+
+		pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL))
+		So(err, ShouldBeNil)
+
+		Convey("should return the publish id", func() {
+			serverRequestHandler = func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"publishId":"pub-123"}`))
+			}
+
+			result, err := pn.PublishToInterestsWithResult([]string{"hello"}, testPublishRequest)
+			So(err, ShouldBeNil)
+			So(result.PublishId, ShouldEqual, "pub-123")
+		})
+
+		Convey("should return the request id of the response", func() {
+			serverRequestHandler = func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Request-Id", "req-789")
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"publishId":"pub-123"}`))
+			}
+
+			result, err := pn.PublishToInterestsWithResult([]string{"hello"}, testPublishRequest)
+			So(err, ShouldBeNil)
+			So(result.RequestId, ShouldEqual, "req-789")
+		})
+
+		Convey("should return the time spent validating and on the network", func() {
+			serverRequestHandler = func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(50 * time.Millisecond)
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"publishId":"pub-123"}`))
+			}
+
+			result, err := pn.PublishToInterestsWithResult([]string{"hello"}, testPublishRequest)
+			So(err, ShouldBeNil)
+			So(result.ValidationDuration, ShouldBeGreaterThan, 0)
+			So(result.NetworkDuration, ShouldBeGreaterThanOrEqualTo, 50*time.Millisecond)
+			So(result.NetworkDuration, ShouldBeGreaterThan, result.ValidationDuration)
+		})
+
+		Convey("should return the request id of a failed publish in the `APIError`", func() {
+			serverRequestHandler = func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Request-Id", "req-789")
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"Bad Request","description":"nope"}`))
+			}
+
+			_, err := pn.PublishToInterestsWithResult([]string{"hello"}, testPublishRequest)
+			var apiError *APIError
+			So(errors.As(err, &apiError), ShouldBeTrue)
+			So(apiError.RequestId, ShouldEqual, "req-789")
+		})
+
+		Convey("should not report TLS details without TLS", func() {
+			serverRequestHandler = func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"publishId":"pub-123"}`))
+			}
+
+			result, err := pn.PublishToInterestsWithResult([]string{"hello"}, testPublishRequest)
+			So(err, ShouldBeNil)
+			So(result.TLSVersion, ShouldEqual, 0)
+			So(result.TLSCipherSuite, ShouldEqual, 0)
+		})
+
+		Convey("should report the TLS version and cipher suite of the connection", func() {
+			tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"publishId":"pub-123"}`))
+			}))
+			defer tlsServer.Close()
+
+			pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(tlsServer.URL), WithHTTPClient(tlsServer.Client()))
+			So(err, ShouldBeNil)
+
+			result, err := pn.PublishToInterestsWithResult([]string{"hello"}, testPublishRequest)
+			So(err, ShouldBeNil)
+			So(result.TLSVersion, ShouldBeGreaterThanOrEqualTo, tls.VersionTLS12)
+			So(result.TLSCipherSuite, ShouldNotEqual, 0)
+		})
+
+		Convey("should report the base URL the publish was sent to", func() {
+			serverRequestHandler = func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"publishId":"pub-123"}`))
+			}
+
+			result, err := pn.PublishToInterestsWithResult([]string{"hello"}, testPublishRequest)
+			So(err, ShouldBeNil)
+			So(result.Endpoint, ShouldEqual, testServer.URL)
+		})
+
+		Convey("should report the size of the request and response bodies", func() {
+			var requestBody []byte
+			serverRequestHandler = func(w http.ResponseWriter, r *http.Request) {
+				requestBody, _ = ioutil.ReadAll(r.Body)
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"publishId":"pub-123"}`))
+			}
+
+			request := map[string]interface{}{"fcm": testPublishRequest["fcm"]}
+			result, err := pn.PublishToInterestsWithResult([]string{"hello"}, request)
+			So(err, ShouldBeNil)
+
+			marshalledBody, _ := json.Marshal(map[string]interface{}{
+				"fcm":       testPublishRequest["fcm"],
+				"interests": []string{"hello"},
+			})
+			So(result.RequestBytes, ShouldEqual, len(marshalledBody))
+			So(result.RequestBytes, ShouldEqual, len(requestBody))
+			So(result.ResponseBytes, ShouldEqual, len(`{"publishId":"pub-123"}`))
+
+			Convey("and add them up in the client's stats", func() {
+				_, err := pn.PublishToInterestsWithResult([]string{"hello"}, request)
+				So(err, ShouldBeNil)
+
+				stats := pn.Stats()
+				So(stats.Requests, ShouldEqual, 2)
+				So(stats.RequestBytes, ShouldEqual, 2*result.RequestBytes)
+				So(stats.ResponseBytes, ShouldEqual, 2*result.ResponseBytes)
+			})
+		})
+
+		Convey("should count reused connections in the client's stats", func() {
+			serverRequestHandler = func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"publishId":"pub-123"}`))
+			}
+
+			for i := 0; i < 3; i++ {
+				_, err := pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+				So(err, ShouldBeNil)
+			}
+
+			stats := pn.Stats()
+			So(stats.NewConnections, ShouldEqual, 1)
+			So(stats.ReusedConnections, ShouldEqual, 2)
+		})
+
+		Convey("should report the rate limit from the response headers", func() {
+			serverRequestHandler = func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-RateLimit-Limit", "100")
+				w.Header().Set("X-RateLimit-Remaining", "42")
+				w.Header().Set("X-RateLimit-Reset", "1700000000")
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"publishId":"pub-123"}`))
+			}
+
+			result, err := pn.PublishToInterestsWithResult([]string{"hello"}, testPublishRequest)
+			So(err, ShouldBeNil)
+			So(result.RateLimit, ShouldResemble, RateLimit{
+				Limit:     100,
+				Remaining: 42,
+				Reset:     time.Unix(1700000000, 0),
+			})
+		})
+
+		Convey("should accept a rate limit reset given in seconds from now", func() {
+			serverRequestHandler = func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-RateLimit-Reset", "60")
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"publishId":"pub-123"}`))
+			}
+
+			result, err := pn.PublishToInterestsWithResult([]string{"hello"}, testPublishRequest)
+			So(err, ShouldBeNil)
+			So(result.RateLimit.Reset, ShouldHappenWithin, 5*time.Second, time.Now().Add(time.Minute))
+		})
+
+		Convey("should leave the rate limit empty without the headers", func() {
+			serverRequestHandler = func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"publishId":"pub-123"}`))
+			}
+
+			result, err := pn.PublishToInterestsWithResult([]string{"hello"}, testPublishRequest)
+			So(err, ShouldBeNil)
+			So(result.RateLimit, ShouldResemble, RateLimit{})
+		})
+
+		Convey("should still read the publish id if the response carries per-interest match counts", func() {
+			serverRequestHandler = func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"publishId":"pub-123","interests":{"hello":3,"empty":0}}`))
+			}
+
+			result, err := pn.PublishToInterestsWithResult([]string{"hello", "empty"}, testPublishRequest)
+			So(err, ShouldBeNil)
+			So(result.PublishId, ShouldEqual, "pub-123")
+		})
+
+		Convey("given a response without a publish id", func() {
+			serverRequestHandler = func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"publishId":""}`))
+			}
+
+			Convey("should return an empty publish id by default", func() {
+				result, err := pn.PublishToInterestsWithResult([]string{"hello"}, testPublishRequest)
+				So(err, ShouldBeNil)
+				So(result.PublishId, ShouldEqual, "")
+			})
+
+			Convey("should return an error if a publish id is required", func() {
+				pnRequiringId, err := New(testInstanceId, testSecretKey,
+					WithCustomBaseURL(testServer.URL),
+					WithRequireNonEmptyPublishId(),
+				)
+				So(err, ShouldBeNil)
+
+				pubId, err := pnRequiringId.PublishToUsers([]string{"u-123"}, testPublishRequest)
+				So(pubId, ShouldEqual, "")
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "the response did not contain a publish id")
+			})
+		})
+
+		Convey("should return an empty result on failure", func() {
+			serverRequestHandler = func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"123","description":"why"}`))
+			}
+
+			result, err := pn.PublishToInterestsWithResult([]string{"hello"}, testPublishRequest)
+			So(err, ShouldNotBeNil)
+			So(result, ShouldResemble, PublishResult{})
+		})
+	})
+}
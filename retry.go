@@ -0,0 +1,75 @@
+package pushnotifications
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultRetryBaseDelay = 100 * time.Millisecond
+	defaultRetryMaxDelay  = 10 * time.Second
+)
+
+// Decides how long to wait before retrying a failed request to the Beams API.
+type BackoffStrategy interface {
+	// Returns the delay before the given retry, where `attempt` is 1 for the
+	// first retry, 2 for the second, and so on.
+	Delay(attempt int) time.Duration
+}
+
+// The default `BackoffStrategy`: doubles `BaseDelay` on every attempt, up to
+// `MaxDelay`, and picks a random delay between half and all of that value so
+// that many clients retrying at once don't hit the API in lockstep.
+type ExponentialBackoff struct {
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+func (b ExponentialBackoff) Delay(attempt int) time.Duration {
+	if attempt < 1 || b.BaseDelay <= 0 {
+		return 0
+	}
+
+	delay := b.BaseDelay
+	for i := 1; i < attempt && (b.MaxDelay <= 0 || delay < b.MaxDelay) && delay < delay*2; i++ {
+		delay *= 2
+	}
+	if b.MaxDelay > 0 && delay > b.MaxDelay {
+		delay = b.MaxDelay
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+func (pn *pushNotifications) backoffStrategy() BackoffStrategy {
+	if pn.backoff != nil {
+		return pn.backoff
+	}
+
+	return ExponentialBackoff{
+		BaseDelay: pn.retryBaseDelay,
+		MaxDelay:  defaultRetryMaxDelay,
+	}
+}
+
+// Network errors and 5xx responses are worth retrying; anything else
+// (including 4xx responses) will fail the same way again. With
+// `WithRetryableErrorCodes`, a response with an `error` code in its body is
+// retried if and only if that code is one of those given.
+func (pn *pushNotifications) shouldRetry(httpResp *http.Response, responseBytes []byte, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	if len(pn.retryableErrorCodes) > 0 && httpResp.StatusCode != http.StatusOK {
+		errResponse := &errorResponse{}
+		if json.Unmarshal(responseBytes, errResponse) == nil && errResponse.Error != "" {
+			return pn.retryableErrorCodes[errResponse.Error]
+		}
+	}
+
+	return httpResp.StatusCode >= http.StatusInternalServerError
+}
@@ -0,0 +1,281 @@
+package pushnotifications
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type constantBackoff struct {
+	delay    time.Duration
+	attempts []int
+}
+
+func (b *constantBackoff) Delay(attempt int) time.Duration {
+	b.attempts = append(b.attempts, attempt)
+	return b.delay
+}
+
+// Allows `maxAttempts` attempts at every request, to test the backoff alone.
+func withMaxAttempts(maxAttempts int) Option {
+	return func(pn *pushNotifications) {
+		pn.maxAttempts = maxAttempts
+	}
+}
+
+func TestRetries(t *testing.T) {
+	Convey("A Push Notifications Instance with retries", t, func() {
+		var requestTimes []time.Time
+		var statusCodes []int
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestTimes = append(requestTimes, time.Now())
+			statusCode := statusCodes[0]
+			statusCodes = statusCodes[1:]
+			w.WriteHeader(statusCode)
+			if statusCode == http.StatusOK {
+				w.Write([]byte(`{"publishId":"pub-123"}`))
+			} else {
+				w.Write([]byte(`{"error":"Internal Server Error","description":"oops"}`))
+			}
+		}))
+		defer testServer.Close()
+
+		Convey("should wait the delay given by a custom backoff strategy before each retry", func() {
+			statusCodes = []int{
+				http.StatusServiceUnavailable,
+				http.StatusServiceUnavailable,
+				http.StatusServiceUnavailable,
+				http.StatusOK,
+			}
+			backoff := &constantBackoff{delay: 50 * time.Millisecond}
+			pn, err := New(testInstanceId, testSecretKey,
+				WithCustomBaseURL(testServer.URL),
+				withMaxAttempts(4),
+				WithBackoffStrategy(backoff),
+			)
+			So(err, ShouldBeNil)
+
+			pubId, err := pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+			So(err, ShouldBeNil)
+			So(pubId, ShouldEqual, "pub-123")
+
+			So(backoff.attempts, ShouldResemble, []int{1, 2, 3})
+			So(requestTimes, ShouldHaveLength, 4)
+			for i := 1; i < len(requestTimes); i++ {
+				waited := requestTimes[i].Sub(requestTimes[i-1])
+				So(waited, ShouldBeGreaterThanOrEqualTo, 50*time.Millisecond)
+				So(waited, ShouldBeLessThan, 500*time.Millisecond)
+			}
+		})
+
+		Convey("should give up after the maximum number of attempts", func() {
+			statusCodes = []int{
+				http.StatusInternalServerError,
+				http.StatusInternalServerError,
+			}
+			pn, err := New(testInstanceId, testSecretKey,
+				WithCustomBaseURL(testServer.URL),
+				WithRetries(2, time.Millisecond),
+			)
+			So(err, ShouldBeNil)
+
+			pubId, err := pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+			So(pubId, ShouldEqual, "")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "oops")
+			So(requestTimes, ShouldHaveLength, 2)
+		})
+
+		Convey("should not retry a 4xx response", func() {
+			statusCodes = []int{http.StatusBadRequest}
+			pn, err := New(testInstanceId, testSecretKey,
+				WithCustomBaseURL(testServer.URL),
+				WithRetries(3, time.Millisecond),
+			)
+			So(err, ShouldBeNil)
+
+			_, err = pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+			So(err, ShouldNotBeNil)
+			So(requestTimes, ShouldHaveLength, 1)
+
+			statusCodes = []int{http.StatusNotFound}
+			err = pn.DeleteUser("u-123")
+			So(err, ShouldNotBeNil)
+			So(requestTimes, ShouldHaveLength, 2)
+		})
+
+		Convey("should retry a user deletion", func() {
+			statusCodes = []int{http.StatusBadGateway, http.StatusOK}
+			pn, err := New(testInstanceId, testSecretKey,
+				WithCustomBaseURL(testServer.URL),
+				WithRetries(3, time.Millisecond),
+			)
+			So(err, ShouldBeNil)
+
+			So(pn.DeleteUser("u-123"), ShouldBeNil)
+			So(requestTimes, ShouldHaveLength, 2)
+		})
+
+		Convey("should stop retrying as soon as the context is cancelled", func() {
+			statusCodes = []int{
+				http.StatusServiceUnavailable,
+				http.StatusServiceUnavailable,
+			}
+			pn, err := New(testInstanceId, testSecretKey,
+				WithCustomBaseURL(testServer.URL),
+				WithRetries(2, time.Hour),
+				WithBackoffStrategy(&constantBackoff{delay: time.Hour}),
+			)
+			So(err, ShouldBeNil)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			_, err = pn.PublishToInterestsWithContext(ctx, []string{"hello"}, testPublishRequest)
+			So(time.Since(start), ShouldBeLessThan, time.Second)
+			So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+			So(err.Error(), ShouldContainSubstring, "cancelled or timed out")
+			So(requestTimes, ShouldHaveLength, 1)
+		})
+
+		Convey("should bound each attempt with the per attempt timeout", func() {
+			var attempts int32
+			slowThenFastServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// Reading the body lets the server notice the client giving up.
+				ioutil.ReadAll(r.Body)
+				if atomic.AddInt32(&attempts, 1) == 1 {
+					select {
+					case <-time.After(time.Second):
+					case <-r.Context().Done():
+					}
+					return
+				}
+				w.Write([]byte(`{"publishId":"pub-123"}`))
+			}))
+			defer slowThenFastServer.Close()
+
+			pn, err := New(testInstanceId, testSecretKey,
+				WithCustomBaseURL(slowThenFastServer.URL),
+				WithRetries(2, time.Millisecond),
+				WithPerAttemptTimeout(50*time.Millisecond),
+			)
+			So(err, ShouldBeNil)
+
+			start := time.Now()
+			pubId, err := pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+			So(err, ShouldBeNil)
+			So(pubId, ShouldEqual, "pub-123")
+			So(time.Since(start), ShouldBeLessThan, 500*time.Millisecond)
+			So(atomic.LoadInt32(&attempts), ShouldEqual, 2)
+		})
+
+		Convey("should not create an instance with a non-positive per attempt timeout", func() {
+			pn, err := New(testInstanceId, testSecretKey, WithPerAttemptTimeout(0))
+			So(pn, ShouldBeNil)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Per attempt timeout must be positive")
+		})
+
+		Convey("should not create an instance with fewer than one attempt", func() {
+			pn, err := New(testInstanceId, testSecretKey, WithRetries(0, time.Millisecond))
+			So(pn, ShouldBeNil)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Max attempts must be at least 1, got 0")
+		})
+
+		Convey("should not create an instance with a negative base delay", func() {
+			pn, err := New(testInstanceId, testSecretKey, WithRetries(3, -time.Millisecond))
+			So(pn, ShouldBeNil)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Retry base delay cannot be negative")
+		})
+	})
+
+	Convey("The default exponential backoff", t, func() {
+		backoff := ExponentialBackoff{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+		Convey("should grow with every attempt, with jitter", func() {
+			So(backoff.Delay(1), ShouldBeBetweenOrEqual, 50*time.Millisecond, 100*time.Millisecond)
+			So(backoff.Delay(2), ShouldBeBetweenOrEqual, 100*time.Millisecond, 200*time.Millisecond)
+			So(backoff.Delay(3), ShouldBeBetweenOrEqual, 200*time.Millisecond, 400*time.Millisecond)
+		})
+
+		Convey("should not exceed the maximum delay", func() {
+			So(backoff.Delay(50), ShouldBeBetweenOrEqual, 500*time.Millisecond, time.Second)
+		})
+	})
+}
+
+func TestRetryableErrorCodes(t *testing.T) {
+	Convey("A Push Notifications Instance with retryable error codes", t, func() {
+		type response struct {
+			statusCode int
+			body       string
+		}
+		var responses []response
+		requests := 0
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			next := responses[0]
+			responses = responses[1:]
+			w.WriteHeader(next.statusCode)
+			w.Write([]byte(next.body))
+		}))
+		defer testServer.Close()
+
+		pn, err := New(testInstanceId, testSecretKey,
+			WithCustomBaseURL(testServer.URL),
+			WithRetries(3, time.Millisecond),
+			WithRetryableErrorCodes("Service Unavailable", "Gateway Busy"),
+		)
+		So(err, ShouldBeNil)
+
+		Convey("should retry a response with a listed error code", func() {
+			responses = []response{
+				{http.StatusServiceUnavailable, `{"error":"Service Unavailable","description":"try again"}`},
+				{http.StatusTooManyRequests, `{"error":"Gateway Busy","description":"try again"}`},
+				{http.StatusOK, `{"publishId":"pub-123"}`},
+			}
+
+			publishId, err := pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+			So(err, ShouldBeNil)
+			So(publishId, ShouldEqual, "pub-123")
+			So(requests, ShouldEqual, 3)
+		})
+
+		Convey("should not retry a response with another error code", func() {
+			responses = []response{
+				{http.StatusServiceUnavailable, `{"error":"Instance Disabled","description":"nope"}`},
+			}
+
+			_, err := pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+			So(err, ShouldNotBeNil)
+			So(requests, ShouldEqual, 1)
+		})
+
+		Convey("should still retry a 5xx response without an error code", func() {
+			responses = []response{
+				{http.StatusBadGateway, `<html>Bad Gateway</html>`},
+				{http.StatusOK, `{"publishId":"pub-123"}`},
+			}
+
+			_, err := pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+			So(err, ShouldBeNil)
+			So(requests, ShouldEqual, 2)
+		})
+
+		Convey("should not create an instance without any error codes", func() {
+			noPN, err := New(testInstanceId, testSecretKey, WithRetryableErrorCodes())
+			So(err, ShouldNotBeNil)
+			So(noPN, ShouldBeNil)
+		})
+	})
+}
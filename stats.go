@@ -0,0 +1,65 @@
+package pushnotifications
+
+import (
+	"net/http/httptrace"
+	"sync/atomic"
+)
+
+// A snapshot of cumulative counters about the requests a client has made to
+// the Beams API, as returned by `Stats`. Retried attempts count as separate
+// requests.
+type Stats struct {
+	// The number of requests sent.
+	Requests uint64
+	// The total size of the request bodies sent, in bytes.
+	RequestBytes uint64
+	// The total size of the response bodies received, in bytes.
+	ResponseBytes uint64
+	// The number of requests sent on a newly opened connection.
+	NewConnections uint64
+	// The number of requests sent on a connection kept alive from an earlier
+	// request. If this stays at 0, connections aren't being reused.
+	ReusedConnections uint64
+}
+
+// The live counters behind `Stats`. Allocated on its own so that the 64-bit
+// fields are aligned for atomic access on 32-bit platforms.
+type statsCounters struct {
+	requests      uint64
+	requestBytes  uint64
+	responseBytes uint64
+
+	newConnections    uint64
+	reusedConnections uint64
+}
+
+func (c *statsCounters) recordAttempt(requestBytes, responseBytes int) {
+	atomic.AddUint64(&c.requests, 1)
+	atomic.AddUint64(&c.requestBytes, uint64(requestBytes))
+	atomic.AddUint64(&c.responseBytes, uint64(responseBytes))
+}
+
+// Returns a trace counting whether each request gets a new or reused
+// connection.
+func (c *statsCounters) connectionTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddUint64(&c.reusedConnections, 1)
+			} else {
+				atomic.AddUint64(&c.newConnections, 1)
+			}
+		},
+	}
+}
+
+func (pn *pushNotifications) Stats() Stats {
+	return Stats{
+		Requests:      atomic.LoadUint64(&pn.stats.requests),
+		RequestBytes:  atomic.LoadUint64(&pn.stats.requestBytes),
+		ResponseBytes: atomic.LoadUint64(&pn.stats.responseBytes),
+
+		NewConnections:    atomic.LoadUint64(&pn.stats.newConnections),
+		ReusedConnections: atomic.LoadUint64(&pn.stats.reusedConnections),
+	}
+}
@@ -0,0 +1,80 @@
+package pushnotifications
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// A request the client would have sent to the Beams API in test mode.
+type RecordedRequest struct {
+	Method string
+	URL    string
+	// The request headers, with the Secret Key in `Authorization` redacted.
+	Header http.Header
+	Body   []byte
+}
+
+// A transport that records requests instead of sending them, and answers
+// each one as the Beams API would a successful call.
+type recordingTransport struct {
+	mu       sync.Mutex
+	requests []RecordedRequest
+}
+
+func (t *recordingTransport) RoundTrip(httpReq *http.Request) (*http.Response, error) {
+	var body []byte
+	if httpReq.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(httpReq.Body)
+		httpReq.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	header := httpReq.Header.Clone()
+	if authorization := header.Get("Authorization"); authorization != "" {
+		scheme := strings.SplitN(authorization, " ", 2)[0]
+		header.Set("Authorization", scheme+" ***")
+	}
+
+	t.mu.Lock()
+	t.requests = append(t.requests, RecordedRequest{
+		Method: httpReq.Method,
+		URL:    httpReq.URL.String(),
+		Header: header,
+		Body:   body,
+	})
+	count := len(t.requests)
+	t.mu.Unlock()
+
+	responseBytes := []byte{}
+	if httpReq.Method == http.MethodPost {
+		responseBytes = []byte(fmt.Sprintf(`{"publishId":"test-publish-%d"}`, count))
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(responseBytes)),
+		ContentLength: int64(len(responseBytes)),
+		Request:       httpReq,
+	}, nil
+}
+
+func (pn *pushNotifications) RecordedRequests() []RecordedRequest {
+	if pn.testModeTransport == nil {
+		return nil
+	}
+
+	pn.testModeTransport.mu.Lock()
+	defer pn.testModeTransport.mu.Unlock()
+	return append([]RecordedRequest(nil), pn.testModeTransport.requests...)
+}
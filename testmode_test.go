@@ -0,0 +1,56 @@
+package pushnotifications
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTestMode(t *testing.T) {
+	Convey("A Push Notifications Instance in test mode", t, func() {
+		var serverRequests int32
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&serverRequests, 1)
+		}))
+		defer testServer.Close()
+
+		pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL), WithTestMode())
+		So(err, ShouldBeNil)
+
+		Convey("should record requests instead of sending them", func() {
+			publishId, err := pn.PublishToInterests([]string{"hello"}, testPublishRequest)
+			So(err, ShouldBeNil)
+			So(publishId, ShouldEqual, "test-publish-1")
+			So(pn.DeleteUser("u-123"), ShouldBeNil)
+
+			So(atomic.LoadInt32(&serverRequests), ShouldEqual, 0)
+
+			requests := pn.RecordedRequests()
+			So(requests, ShouldHaveLength, 2)
+			So(requests[0].Method, ShouldEqual, http.MethodPost)
+			So(requests[0].URL, ShouldEqual, testServer.URL+"/publish_api/v1/instances/i-123/publishes")
+			So(string(requests[0].Body), ShouldContainSubstring, `"interests":["hello"]`)
+			So(requests[0].Header.Get("Authorization"), ShouldEqual, "Bearer ***")
+			So(requests[0].Header.Get("X-Pusher-Library"), ShouldStartWith, "pusher-push-notifications-go ")
+			So(requests[1].Method, ShouldEqual, http.MethodDelete)
+			So(requests[1].URL, ShouldEqual, testServer.URL+"/customer_api/v1/instances/i-123/users/u-123")
+			So(requests[1].Body, ShouldBeEmpty)
+		})
+
+		Convey("should not record requests that fail validation", func() {
+			_, err := pn.PublishToInterests([]string{"not valid"}, testPublishRequest)
+			So(err, ShouldNotBeNil)
+			So(pn.RecordedRequests(), ShouldBeEmpty)
+		})
+
+		Convey("should not record requests outside of test mode", func() {
+			pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL))
+			So(err, ShouldBeNil)
+			So(pn.DeleteUser("u-123"), ShouldBeNil)
+			So(pn.RecordedRequests(), ShouldBeNil)
+		})
+	})
+}
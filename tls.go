@@ -0,0 +1,74 @@
+package pushnotifications
+
+import (
+	"crypto/tls"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Enforced by the SDK itself, as Go's client only defaults to it from Go 1.18.
+const defaultMinTLSVersion = tls.VersionTLS12
+
+var (
+	defaultTLSTransportOnce sync.Once
+	defaultTLSTransport     *http.Transport
+)
+
+// Returns a copy of the default transport requiring `defaultMinTLSVersion`,
+// shared by every instance using the defaults so that they share its
+// connection pool too.
+func sharedDefaultTLSTransport() *http.Transport {
+	defaultTLSTransportOnce.Do(func() {
+		defaultTLSTransport = http.DefaultTransport.(*http.Transport).Clone()
+		if defaultTLSTransport.TLSClientConfig == nil {
+			defaultTLSTransport.TLSClientConfig = &tls.Config{}
+		}
+		defaultTLSTransport.TLSClientConfig.MinVersion = defaultMinTLSVersion
+	})
+	return defaultTLSTransport
+}
+
+// Makes the HTTP client refuse TLS versions older than `pn.minTLSVersion`.
+// The transport is only replaced when its policy is looser than that.
+// Transports other than `*http.Transport` can't be configured from here, so
+// they're left to enforce their own policy.
+func (pn *pushNotifications) enforceMinTLSVersion() {
+	if pn.httpClient.Transport == nil && pn.minTLSVersion == defaultMinTLSVersion {
+		httpClient := *pn.httpClient
+		httpClient.Transport = sharedDefaultTLSTransport()
+		pn.httpClient = &httpClient
+		return
+	}
+
+	transport, err := pn.transport()
+	if err != nil {
+		return
+	}
+	if transport.TLSClientConfig != nil && transport.TLSClientConfig.MinVersion >= pn.minTLSVersion {
+		return
+	}
+
+	transport, _ = pn.mutableTransport()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.MinVersion = pn.minTLSVersion
+}
+
+// Makes the HTTP client use the TLS config set with `WithTLSConfig`, if any.
+// Other transports than `*http.Transport` are rejected, as the config can't
+// be applied to them.
+func (pn *pushNotifications) applyTLSConfig() error {
+	if pn.tlsConfig == nil {
+		return nil
+	}
+
+	transport, err := pn.mutableTransport()
+	if err != nil {
+		return errors.Wrap(err, "TLS config cannot be used")
+	}
+	transport.TLSClientConfig = pn.tlsConfig.Clone()
+	return nil
+}
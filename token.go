@@ -0,0 +1,213 @@
+package pushnotifications
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"runtime"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// A token authenticating a user with Beams, as returned by `GenerateBeamsToken`.
+// It marshals to the `{"token": "..."}` JSON the Beams client SDKs expect.
+type BeamsToken struct {
+	// The signed JWT.
+	Token string `json:"token"`
+	// When the token was issued, and when it becomes valid, from its `iat`
+	// and `nbf` claims. A token is valid from a minute before it is issued,
+	// to allow for verifiers whose clock is behind.
+	IssuedAt  time.Time `json:"-"`
+	NotBefore time.Time `json:"-"`
+	// When the token expires.
+	ExpiresAt time.Time `json:"-"`
+	// The id of the key the token was signed with, from its `kid` header,
+	// as set with `WithSigningKeyID`. Empty without it.
+	KeyId string `json:"-"`
+}
+
+func (pn *pushNotifications) GenerateBeamsToken(userId string) (BeamsToken, error) {
+	tokenString, claims, err := pn.GenerateTokenWithClaimsResult(userId)
+	if err != nil {
+		return BeamsToken{}, err
+	}
+
+	return BeamsToken{
+		Token:     tokenString,
+		IssuedAt:  time.Unix(claims["iat"].(int64), 0),
+		NotBefore: time.Unix(claims["nbf"].(int64), 0),
+		ExpiresAt: time.Unix(claims["exp"].(int64), 0),
+		KeyId:     pn.signingKeyId,
+	}, nil
+}
+
+// Why `VerifyToken` rejected a token. The returned errors wrap one of these,
+// so use `errors.Is` to tell them apart.
+var (
+	ErrTokenMalformed        = errors.New("token malformed")
+	ErrTokenSignatureInvalid = errors.New("token signature invalid")
+	ErrTokenExpired          = errors.New("token expired")
+	ErrTokenNotYetValid      = errors.New("token not yet valid")
+	ErrTokenIssuerMismatch   = errors.New("token issuer mismatch")
+)
+
+// The `iss` claim of the tokens generated for this instance.
+func (pn *pushNotifications) tokenIssuer() string {
+	return "https://" + pn.InstanceId + ".pushnotifications.pusher.com"
+}
+
+// The method and key tokens are signed with: HS256 with the Secret Key,
+// unless set with `WithSigningMethod`.
+func (pn *pushNotifications) tokenSigning() (jwt.SigningMethod, interface{}) {
+	if pn.signingMethod == nil {
+		return jwt.SigningMethodHS256, []byte(pn.SecretKey)
+	}
+
+	return pn.signingMethod, pn.signingKey
+}
+
+// Returns an error if `key` can't be used to sign tokens with `method`.
+func checkSigningKey(method jwt.SigningMethod, key interface{}) error {
+	switch method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if hmacKey, ok := key.([]byte); !ok || len(hmacKey) == 0 {
+			return errors.Errorf("%s needs a non-empty []byte key, got %T", method.Alg(), key)
+		}
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if _, ok := key.(*rsa.PrivateKey); !ok {
+			return errors.Errorf("%s needs an *rsa.PrivateKey, got %T", method.Alg(), key)
+		}
+	case *jwt.SigningMethodECDSA:
+		ecdsaKey, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return errors.Errorf("%s needs an *ecdsa.PrivateKey, got %T", method.Alg(), key)
+		}
+		if ecdsaKey.Curve.Params().BitSize != method.(*jwt.SigningMethodECDSA).CurveBits {
+			return errors.Errorf("%s needs a key on a %d bit curve, got %d bits",
+				method.Alg(), method.(*jwt.SigningMethodECDSA).CurveBits, ecdsaKey.Curve.Params().BitSize)
+		}
+	default:
+		return errors.Errorf("Unsupported signing method %s", method.Alg())
+	}
+
+	return nil
+}
+
+// Returns the key verifying tokens signed with `signingKey`: the public half
+// of an asymmetric key, or the shared key itself.
+func verificationKey(signingKey interface{}) interface{} {
+	switch key := signingKey.(type) {
+	case *rsa.PrivateKey:
+		return &key.PublicKey
+	case *ecdsa.PrivateKey:
+		return &key.PublicKey
+	default:
+		return key
+	}
+}
+
+func (pn *pushNotifications) VerifyToken(token string) (string, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(parsed *jwt.Token) (interface{}, error) {
+		// Only accept the method tokens are signed with, so that a token
+		// can't pick a weaker one.
+		signingMethod, signingKey := pn.tokenSigning()
+		if parsed.Method != signingMethod {
+			return nil, errors.Errorf("unexpected signing method %v", parsed.Header["alg"])
+		}
+		return verificationKey(signingKey), nil
+	})
+	if err != nil {
+		validationErr, ok := err.(*jwt.ValidationError)
+		switch {
+		case !ok || validationErr.Errors&jwt.ValidationErrorMalformed != 0:
+			return "", errors.Wrapf(ErrTokenMalformed, "Failed to verify token: %s", err)
+		case validationErr.Errors&(jwt.ValidationErrorSignatureInvalid|jwt.ValidationErrorUnverifiable) != 0:
+			// Checked before the claims, which can't be trusted without a valid signature.
+			return "", errors.Wrapf(ErrTokenSignatureInvalid, "Failed to verify token: %s", err)
+		case validationErr.Errors&jwt.ValidationErrorExpired != 0:
+			return "", errors.Wrapf(ErrTokenExpired, "Failed to verify token: %s", err)
+		case validationErr.Errors&(jwt.ValidationErrorNotValidYet|jwt.ValidationErrorIssuedAt) != 0:
+			return "", errors.Wrapf(ErrTokenNotYetValid, "Failed to verify token: %s", err)
+		default:
+			return "", errors.Wrapf(ErrTokenMalformed, "Failed to verify token: %s", err)
+		}
+	}
+
+	if !claims.VerifyIssuer(pn.tokenIssuer(), true) {
+		return "", errors.Wrapf(ErrTokenIssuerMismatch, "Failed to verify token: issued by %v, not this instance", claims["iss"])
+	}
+	userId, _ := claims["sub"].(string)
+	if userId == "" {
+		return "", errors.Wrap(ErrTokenMalformed, "Failed to verify token: no user id")
+	}
+
+	return userId, nil
+}
+
+// Reports whether `token` has expired, from its `exp` claim. The signature is
+// not checked, so no key is needed, but the result can't be trusted for
+// authentication: use `VerifyToken` for that. Returns an error wrapping
+// `ErrTokenMalformed` if the token can't be parsed or has no expiry.
+func IsTokenExpired(token string) (bool, error) {
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(token, claims); err != nil {
+		return false, errors.Wrapf(ErrTokenMalformed, "Failed to parse token: %s", err)
+	}
+	if _, ok := claims["exp"].(float64); !ok {
+		return false, errors.Wrap(ErrTokenMalformed, "Failed to parse token: no numeric expiry")
+	}
+
+	return !claims.VerifyExpiresAt(time.Now().Unix(), true), nil
+}
+
+func (pn *pushNotifications) GenerateTokensConcurrent(ctx context.Context, userIds []string, concurrency int) (map[string]string, map[string]error) {
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+
+	var mu sync.Mutex
+	tokens := make(map[string]string, len(userIds))
+	tokenErrors := map[string]error{}
+
+	userIdsToSign := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for userId := range userIdsToSign {
+				token, _, err := pn.GenerateTokenWithClaimsResult(userId)
+
+				mu.Lock()
+				if err != nil {
+					tokenErrors[userId] = err
+				} else {
+					tokens[userId] = token
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+dispatch:
+	for i, userId := range userIds {
+		select {
+		case userIdsToSign <- userId:
+		case <-ctx.Done():
+			mu.Lock()
+			for _, skipped := range userIds[i:] {
+				tokenErrors[skipped] = ctx.Err()
+			}
+			mu.Unlock()
+			break dispatch
+		}
+	}
+	close(userIdsToSign)
+	wg.Wait()
+
+	return tokens, tokenErrors
+}
@@ -0,0 +1,352 @@
+package pushnotifications
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGenerateTokensConcurrent(t *testing.T) {
+	Convey("A Push Notifications Instance generating many tokens", t, func() {
+		pn, err := New(testInstanceId, testSecretKey)
+		So(err, ShouldBeNil)
+
+		userIds := make([]string, 100)
+		for i := range userIds {
+			userIds[i] = fmt.Sprintf("u-%d", i)
+		}
+
+		Convey("should generate a token for every user", func() {
+			tokens, errs := pn.GenerateTokensConcurrent(context.Background(), userIds, 4)
+			So(errs, ShouldBeEmpty)
+			So(tokens, ShouldHaveLength, len(userIds))
+
+			for _, userId := range userIds {
+				parsedToken, err := jwt.Parse(tokens[userId], func(token *jwt.Token) (interface{}, error) {
+					return []byte(testSecretKey), nil
+				})
+				So(err, ShouldBeNil)
+				So(parsedToken.Claims.(jwt.MapClaims)["sub"], ShouldEqual, userId)
+			}
+		})
+
+		Convey("should report invalid user ids without stopping", func() {
+			tokens, errs := pn.GenerateTokensConcurrent(context.Background(), []string{"u-1", "", "u-3"}, 2)
+			So(tokens, ShouldHaveLength, 2)
+			So(errs, ShouldHaveLength, 1)
+			So(errs[""].Error(), ShouldContainSubstring, "User Id cannot be empty")
+		})
+
+		Convey("should stop generating tokens once the context is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			tokens, errs := pn.GenerateTokensConcurrent(ctx, userIds, 4)
+			So(len(tokens)+len(errs), ShouldEqual, len(userIds))
+			So(len(tokens), ShouldBeLessThan, len(userIds))
+			for _, err := range errs {
+				So(err, ShouldEqual, context.Canceled)
+			}
+		})
+	})
+}
+
+func TestGenerateBeamsToken(t *testing.T) {
+	Convey("A Push Notifications Instance generating a Beams token", t, func() {
+		pn, err := New(testInstanceId, testSecretKey, WithTokenTTL(time.Hour))
+		So(err, ShouldBeNil)
+
+		Convey("should return the signed JWT and its expiry", func() {
+			beamsToken, err := pn.GenerateBeamsToken("u-123")
+			So(err, ShouldBeNil)
+
+			parsed, err := jwt.Parse(beamsToken.Token, func(*jwt.Token) (interface{}, error) {
+				return []byte(testSecretKey), nil
+			})
+			So(err, ShouldBeNil)
+			claims := parsed.Claims.(jwt.MapClaims)
+			So(claims["sub"], ShouldEqual, "u-123")
+			So(beamsToken.ExpiresAt.Unix(), ShouldEqual, int64(claims["exp"].(float64)))
+			So(beamsToken.ExpiresAt, ShouldHappenWithin, time.Minute, time.Now().Add(time.Hour))
+		})
+
+		Convey("should return when the token was issued and becomes valid", func() {
+			before := time.Now().Truncate(time.Second)
+			beamsToken, err := pn.GenerateBeamsToken("u-123")
+			So(err, ShouldBeNil)
+
+			parsed, err := jwt.Parse(beamsToken.Token, func(*jwt.Token) (interface{}, error) {
+				return []byte(testSecretKey), nil
+			})
+			So(err, ShouldBeNil)
+			claims := parsed.Claims.(jwt.MapClaims)
+			So(beamsToken.IssuedAt.Unix(), ShouldEqual, int64(claims["iat"].(float64)))
+			So(beamsToken.NotBefore.Unix(), ShouldEqual, int64(claims["nbf"].(float64)))
+			So(beamsToken.NotBefore, ShouldEqual, beamsToken.IssuedAt.Add(-time.Minute))
+			So(beamsToken.IssuedAt, ShouldHappenOnOrAfter, before)
+		})
+
+		Convey("should marshal to the JSON the client SDKs expect", func() {
+			beamsToken, err := pn.GenerateBeamsToken("u-123")
+			So(err, ShouldBeNil)
+
+			tokenJSON, err := json.Marshal(beamsToken)
+			So(err, ShouldBeNil)
+			So(string(tokenJSON), ShouldEqual, `{"token":"`+beamsToken.Token+`"}`)
+		})
+
+		Convey("should fail for an invalid user id", func() {
+			beamsToken, err := pn.GenerateBeamsToken("")
+			So(errors.Is(err, ErrInvalidUserId), ShouldBeTrue)
+			So(beamsToken, ShouldResemble, BeamsToken{})
+		})
+
+		Convey("should back `GenerateToken`", func() {
+			tokenMap, err := pn.GenerateToken("u-123")
+			So(err, ShouldBeNil)
+			So(tokenMap["token"], ShouldNotBeEmpty)
+		})
+	})
+}
+
+func TestVerifyToken(t *testing.T) {
+	Convey("A Push Notifications Instance verifying a token", t, func() {
+		pn, err := New(testInstanceId, testSecretKey)
+		So(err, ShouldBeNil)
+
+		signedToken := func(claims jwt.MapClaims, method jwt.SigningMethod, key interface{}) string {
+			token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+			So(err, ShouldBeNil)
+			return token
+		}
+		validClaims := func() jwt.MapClaims {
+			return jwt.MapClaims{
+				"sub": "u-123",
+				"iat": time.Now().Unix(),
+				"exp": time.Now().Add(time.Hour).Unix(),
+				"iss": "https://i-123.pushnotifications.pusher.com",
+			}
+		}
+
+		Convey("should return the user id of a token it generated", func() {
+			tokenMap, err := pn.GenerateToken("u-123")
+			So(err, ShouldBeNil)
+
+			userId, err := pn.VerifyToken(tokenMap["token"].(string))
+			So(err, ShouldBeNil)
+			So(userId, ShouldEqual, "u-123")
+		})
+
+		Convey("should reject an expired token", func() {
+			claims := validClaims()
+			claims["exp"] = time.Now().Add(-time.Minute).Unix()
+
+			userId, err := pn.VerifyToken(signedToken(claims, jwt.SigningMethodHS256, []byte(testSecretKey)))
+			So(userId, ShouldEqual, "")
+			So(errors.Is(err, ErrTokenExpired), ShouldBeTrue)
+		})
+
+		Convey("should reject a token that isn't valid yet", func() {
+			claims := validClaims()
+			claims["nbf"] = time.Now().Add(time.Hour).Unix()
+
+			_, err := pn.VerifyToken(signedToken(claims, jwt.SigningMethodHS256, []byte(testSecretKey)))
+			So(errors.Is(err, ErrTokenNotYetValid), ShouldBeTrue)
+		})
+
+		Convey("should reject a token issued in the future", func() {
+			claims := validClaims()
+			claims["iat"] = time.Now().Add(time.Hour).Unix()
+
+			_, err := pn.VerifyToken(signedToken(claims, jwt.SigningMethodHS256, []byte(testSecretKey)))
+			So(errors.Is(err, ErrTokenNotYetValid), ShouldBeTrue)
+		})
+
+		Convey("should reject a token signed with another key", func() {
+			_, err := pn.VerifyToken(signedToken(validClaims(), jwt.SigningMethodHS256, []byte("k-789")))
+			So(errors.Is(err, ErrTokenSignatureInvalid), ShouldBeTrue)
+		})
+
+		Convey("should report a bad signature before an expiry", func() {
+			claims := validClaims()
+			claims["exp"] = time.Now().Add(-time.Minute).Unix()
+
+			_, err := pn.VerifyToken(signedToken(claims, jwt.SigningMethodHS256, []byte("k-789")))
+			So(errors.Is(err, ErrTokenSignatureInvalid), ShouldBeTrue)
+		})
+
+		Convey("should reject a token signed with another method", func() {
+			_, err := pn.VerifyToken(signedToken(validClaims(), jwt.SigningMethodHS512, []byte(testSecretKey)))
+			So(errors.Is(err, ErrTokenSignatureInvalid), ShouldBeTrue)
+		})
+
+		Convey("should reject a token issued for another instance", func() {
+			otherPN, err := New("i-789", testSecretKey)
+			So(err, ShouldBeNil)
+			tokenMap, err := otherPN.GenerateToken("u-123")
+			So(err, ShouldBeNil)
+
+			_, err = pn.VerifyToken(tokenMap["token"].(string))
+			So(errors.Is(err, ErrTokenIssuerMismatch), ShouldBeTrue)
+		})
+
+		Convey("should reject a malformed token", func() {
+			_, err := pn.VerifyToken("not-a-token")
+			So(errors.Is(err, ErrTokenMalformed), ShouldBeTrue)
+
+			claims := validClaims()
+			delete(claims, "sub")
+			_, err = pn.VerifyToken(signedToken(claims, jwt.SigningMethodHS256, []byte(testSecretKey)))
+			So(errors.Is(err, ErrTokenMalformed), ShouldBeTrue)
+		})
+	})
+}
+
+func TestIsTokenExpired(t *testing.T) {
+	Convey("Checking whether a token has expired", t, func() {
+		Convey("should report a fresh token as unexpired", func() {
+			pn, err := New(testInstanceId, testSecretKey)
+			So(err, ShouldBeNil)
+			beamsToken, err := pn.GenerateBeamsToken("u-123")
+			So(err, ShouldBeNil)
+
+			expired, err := IsTokenExpired(beamsToken.Token)
+			So(err, ShouldBeNil)
+			So(expired, ShouldBeFalse)
+		})
+
+		Convey("should report an expired token, whatever it was signed with", func() {
+			token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+				"sub": "u-123",
+				"exp": time.Now().Add(-time.Minute).Unix(),
+			}).SignedString([]byte("k-789"))
+			So(err, ShouldBeNil)
+
+			expired, err := IsTokenExpired(token)
+			So(err, ShouldBeNil)
+			So(expired, ShouldBeTrue)
+		})
+
+		Convey("should fail for a malformed token or one without an expiry", func() {
+			noExpiry, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "u-123"}).SignedString([]byte("k-789"))
+			So(err, ShouldBeNil)
+
+			for _, token := range []string{"", "not-a-token", noExpiry} {
+				_, err := IsTokenExpired(token)
+				So(errors.Is(err, ErrTokenMalformed), ShouldBeTrue)
+			}
+		})
+	})
+}
+func TestSigningMethod(t *testing.T) {
+	Convey("A Push Notifications Instance with a custom signing method", t, func() {
+		rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		So(err, ShouldBeNil)
+
+		Convey("should sign tokens with RS256 and a private key", func() {
+			pn, err := New(testInstanceId, testSecretKey, WithSigningMethod(jwt.SigningMethodRS256, rsaKey))
+			So(err, ShouldBeNil)
+
+			tokenString, _, err := pn.GenerateTokenWithClaimsResult("u-123")
+			So(err, ShouldBeNil)
+
+			parsed, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+				So(token.Method, ShouldEqual, jwt.SigningMethodRS256)
+				return &rsaKey.PublicKey, nil
+			})
+			So(err, ShouldBeNil)
+			So(parsed.Valid, ShouldBeTrue)
+
+			userId, err := pn.VerifyToken(tokenString)
+			So(err, ShouldBeNil)
+			So(userId, ShouldEqual, "u-123")
+		})
+
+		Convey("should sign tokens with ES256 and a private key", func() {
+			pn, err := New(testInstanceId, testSecretKey, WithSigningMethod(jwt.SigningMethodES256, ecdsaKey))
+			So(err, ShouldBeNil)
+
+			tokenString, _, err := pn.GenerateTokenWithClaimsResult("u-123")
+			So(err, ShouldBeNil)
+			userId, err := pn.VerifyToken(tokenString)
+			So(err, ShouldBeNil)
+			So(userId, ShouldEqual, "u-123")
+		})
+
+		Convey("should return the signing key id and set it as the `kid` header", func() {
+			pn, err := New(testInstanceId, testSecretKey,
+				WithSigningMethod(jwt.SigningMethodRS256, rsaKey),
+				WithSigningKeyID("key-2026-10"),
+			)
+			So(err, ShouldBeNil)
+
+			beamsToken, err := pn.GenerateBeamsToken("u-123")
+			So(err, ShouldBeNil)
+			So(beamsToken.KeyId, ShouldEqual, "key-2026-10")
+
+			parsed, _, err := new(jwt.Parser).ParseUnverified(beamsToken.Token, jwt.MapClaims{})
+			So(err, ShouldBeNil)
+			So(parsed.Header["kid"], ShouldEqual, beamsToken.KeyId)
+
+			userId, err := pn.VerifyToken(beamsToken.Token)
+			So(err, ShouldBeNil)
+			So(userId, ShouldEqual, "u-123")
+		})
+
+		Convey("should not set a key id unless asked to", func() {
+			pn, err := New(testInstanceId, testSecretKey)
+			So(err, ShouldBeNil)
+
+			beamsToken, err := pn.GenerateBeamsToken("u-123")
+			So(err, ShouldBeNil)
+			So(beamsToken.KeyId, ShouldBeEmpty)
+			parsed, _, err := new(jwt.Parser).ParseUnverified(beamsToken.Token, jwt.MapClaims{})
+			So(err, ShouldBeNil)
+			So(parsed.Header, ShouldNotContainKey, "kid")
+
+			noPN, err := New(testInstanceId, testSecretKey, WithSigningKeyID(""))
+			So(err, ShouldNotBeNil)
+			So(noPN, ShouldBeNil)
+		})
+
+		Convey("should not verify HS256 tokens once another method is set", func() {
+			defaultPN, err := New(testInstanceId, testSecretKey)
+			So(err, ShouldBeNil)
+			tokenString, _, err := defaultPN.GenerateTokenWithClaimsResult("u-123")
+			So(err, ShouldBeNil)
+
+			pn, err := New(testInstanceId, testSecretKey, WithSigningMethod(jwt.SigningMethodRS256, rsaKey))
+			So(err, ShouldBeNil)
+			_, err = pn.VerifyToken(tokenString)
+			So(errors.Is(err, ErrTokenSignatureInvalid), ShouldBeTrue)
+		})
+
+		Convey("should not create an instance with a key that doesn't match the method", func() {
+			for _, option := range []Option{
+				WithSigningMethod(jwt.SigningMethodRS256, ecdsaKey),
+				WithSigningMethod(jwt.SigningMethodRS256, &rsaKey.PublicKey),
+				WithSigningMethod(jwt.SigningMethodES256, rsaKey),
+				WithSigningMethod(jwt.SigningMethodES384, ecdsaKey),
+				WithSigningMethod(jwt.SigningMethodHS256, "secret"),
+				WithSigningMethod(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType),
+				WithSigningMethod(nil, nil),
+			} {
+				pn, err := New(testInstanceId, testSecretKey, option)
+				So(pn, ShouldBeNil)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
@@ -0,0 +1,41 @@
+package pushnotifications
+
+import (
+	"context"
+)
+
+// Starts spans around the SDK's calls to the Beams API, so they can be wired
+// into a tracing library such as OpenTelemetry without the SDK depending on it.
+type Tracer interface {
+	// Starts a span named `name` as a child of any span in `ctx`. Returns the
+	// context to make the call with, and a function ending the span.
+	StartSpan(ctx context.Context, name string) (context.Context, func(SpanAttributes))
+}
+
+// Describes a call to the Beams API when its span ends.
+type SpanAttributes struct {
+	InstanceId string
+	// The kind of call, such as `publish` or `delete_user`.
+	Operation string
+	// The status code of the last response, or 0 if none was received.
+	StatusCode int
+	// Why the call failed, or nil if it succeeded.
+	Err error
+}
+
+// Starts a span for an `operation` on the Beams API, if a tracer is set.
+func (pn *pushNotifications) startSpan(ctx context.Context, operation string) (context.Context, func(statusCode int, err error)) {
+	if pn.tracer == nil {
+		return ctx, func(int, error) {}
+	}
+
+	ctx, end := pn.tracer.StartSpan(ctx, "beams."+operation)
+	return ctx, func(statusCode int, err error) {
+		end(SpanAttributes{
+			InstanceId: pn.InstanceId,
+			Operation:  operation,
+			StatusCode: statusCode,
+			Err:        err,
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package pushnotifications
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type parentSpanKey struct{}
+
+type recordedSpan struct {
+	name       string
+	parent     interface{}
+	attributes SpanAttributes
+}
+
+// A `Tracer` that keeps every span it ends, for assertions.
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []recordedSpan
+}
+
+func (t *recordingTracer) StartSpan(ctx context.Context, name string) (context.Context, func(SpanAttributes)) {
+	parent := ctx.Value(parentSpanKey{})
+	return context.WithValue(ctx, parentSpanKey{}, name), func(attributes SpanAttributes) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.spans = append(t.spans, recordedSpan{name: name, parent: parent, attributes: attributes})
+	}
+}
+
+func TestTracer(t *testing.T) {
+	Convey("A Push Notifications Instance with a tracer", t, func() {
+		var spanInRequest interface{}
+		statusCode := http.StatusOK
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(statusCode)
+			if statusCode == http.StatusOK {
+				w.Write([]byte(`{"publishId":"pub-123"}`))
+			} else {
+				w.Write([]byte(`{"error":"Bad Request","description":"nope"}`))
+			}
+		}))
+		defer testServer.Close()
+
+		tracer := &recordingTracer{}
+		pn, err := New(testInstanceId, testSecretKey,
+			WithCustomBaseURL(testServer.URL),
+			WithTracer(tracer),
+			WithClientTrace(func(ctx context.Context) *httptrace.ClientTrace {
+				spanInRequest = ctx.Value(parentSpanKey{})
+				return nil
+			}),
+		)
+		So(err, ShouldBeNil)
+
+		Convey("should trace a publish as a child of the caller's span", func() {
+			ctx := context.WithValue(context.Background(), parentSpanKey{}, "caller")
+			_, err := pn.PublishToInterestsWithContext(ctx, []string{"hello"}, testPublishRequest)
+			So(err, ShouldBeNil)
+
+			So(tracer.spans, ShouldHaveLength, 1)
+			So(tracer.spans[0].name, ShouldEqual, "beams.publish")
+			So(tracer.spans[0].parent, ShouldEqual, "caller")
+			So(tracer.spans[0].attributes, ShouldResemble, SpanAttributes{
+				InstanceId: testInstanceId,
+				Operation:  "publish",
+				StatusCode: http.StatusOK,
+			})
+			So(spanInRequest, ShouldEqual, "beams.publish")
+		})
+
+		Convey("should record the error of a failed user deletion", func() {
+			statusCode = http.StatusBadRequest
+			err := pn.DeleteUser("u-123")
+			So(err, ShouldNotBeNil)
+
+			So(tracer.spans, ShouldHaveLength, 1)
+			So(tracer.spans[0].name, ShouldEqual, "beams.delete_user")
+			So(tracer.spans[0].attributes.StatusCode, ShouldEqual, http.StatusBadRequest)
+			So(tracer.spans[0].attributes.Err, ShouldEqual, err)
+		})
+
+		Convey("should not start a span for a call that fails validation", func() {
+			So(pn.DeleteUser(""), ShouldNotBeNil)
+			So(tracer.spans, ShouldBeEmpty)
+		})
+
+		Convey("should not create an instance with a nil tracer", func() {
+			pn, err := New(testInstanceId, testSecretKey, WithTracer(nil))
+			So(pn, ShouldBeNil)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
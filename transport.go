@@ -0,0 +1,40 @@
+package pushnotifications
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// Returns the `*http.Transport` the HTTP client sends requests with, which is
+// the default transport if none was set. Other transports can't be configured
+// from here, so an error is returned for them.
+func (pn *pushNotifications) transport() (*http.Transport, error) {
+	switch t := pn.httpClient.Transport.(type) {
+	case nil:
+		return http.DefaultTransport.(*http.Transport), nil
+	case *http.Transport:
+		return t, nil
+	default:
+		return nil, errors.Errorf("transport of type %T cannot be configured", t)
+	}
+}
+
+// Returns a transport that may be changed to configure the HTTP client. The
+// default or caller's transport is cloned the first time, so that it is left
+// untouched, and the clone is reused by later calls.
+func (pn *pushNotifications) mutableTransport() (*http.Transport, error) {
+	transport, err := pn.transport()
+	if err != nil {
+		return nil, err
+	}
+	if transport == pn.ownTransport {
+		return transport, nil
+	}
+
+	pn.ownTransport = transport.Clone()
+	httpClient := *pn.httpClient
+	httpClient.Transport = pn.ownTransport
+	pn.httpClient = &httpClient
+	return pn.ownTransport, nil
+}
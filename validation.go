@@ -0,0 +1,281 @@
+package pushnotifications
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Codes for the validation rules, as logged when one fails.
+const (
+	ruleNoInterests               = "no_interests"
+	ruleTooManyInterests          = "too_many_interests"
+	ruleEmptyInterest             = "empty_interest"
+	ruleInterestTooLong           = "interest_too_long"
+	ruleInterestInvalidCharacters = "interest_invalid_characters"
+	ruleInterestMissingPrefix     = "interest_missing_prefix"
+	ruleInterestPunctuationOnly   = "interest_punctuation_only"
+	ruleNoUsers                   = "no_users"
+	ruleTooManyUsers              = "too_many_users"
+	ruleEmptyUserId               = "empty_user_id"
+	ruleUserIdTooLong             = "user_id_too_long"
+	ruleUserIdInvalidUTF8         = "user_id_invalid_utf8"
+	rulePayloadTooDeep            = "payload_too_deep"
+	rulePayloadNoPlatforms        = "payload_no_platforms"
+	rulePayloadTooLarge           = "payload_too_large"
+)
+
+// Invalid arguments are reported with one of these errors, wrapped with the
+// details, so use `errors.Is` to tell them apart.
+var (
+	ErrNoInterests         = errors.New("no interests")
+	ErrTooManyInterests    = errors.New("too many interests")
+	ErrInvalidInterestName = errors.New("invalid interest name")
+	ErrNoUsers             = errors.New("no user ids")
+	ErrTooManyUsers        = errors.New("too many user ids")
+	ErrInvalidUserId       = errors.New("invalid user id")
+	ErrUserIdTooLong       = errors.New("user id too long")
+	ErrPayloadTooDeep      = errors.New("payload too deep")
+	ErrNoPlatforms         = errors.New("no platform payloads")
+	ErrPayloadTooLarge     = errors.New("payload too large")
+)
+
+// Returns the regular expression interest names must match, e.g. to show the
+// rules in a UI. Interests must also be at most 164 characters long, or the
+// length set by `WithMaxInterestLength`, and start with the prefix set by
+// `WithInterestPrefix`, if any.
+func InterestValidationPattern() string {
+	return interestValidationRegex.String()
+}
+
+// Logs that the validation `rule` rejected `value` at debug level, and
+// returns `err`. String values are redacted, as they may be personal data.
+func (pn *pushNotifications) validationFailed(rule string, value interface{}, err error) error {
+	if s, ok := value.(string); ok {
+		value = redact(printable(s))
+	}
+	pn.logger.Debugf("Validation failed: rule=%s value=%v", rule, value)
+
+	return err
+}
+
+// The largest publish request, without the interests or user ids, that is
+// sent unless set with `WithMaxPayloadBytes`.
+const defaultMaxPayloadBytes = 4 * 1024
+
+// The platforms a publish request can have payloads for, unless set with
+// `WithPlatforms`.
+var defaultPlatforms = []string{"apns", "fcm", "web"}
+
+// Checks that `request` has a payload for a platform, and meets the limits set
+// by options, before it's marshalled.
+func (pn *pushNotifications) validatePayload(request map[string]interface{}) error {
+	hasKey := func(key string) bool {
+		_, ok := request[key]
+		return ok
+	}
+	if err := pn.validatePlatforms(hasKey, len(request)); err != nil {
+		return err
+	}
+	return pn.validateDepth(request)
+}
+
+// Checks that a publish request with `keys` top-level keys has a payload for
+// one of the platforms, using `hasKey` to look up its keys.
+func (pn *pushNotifications) validatePlatforms(hasKey func(key string) bool, keys int) error {
+	for _, platform := range pn.platforms {
+		if hasKey(platform) {
+			return nil
+		}
+	}
+	return pn.validationFailed(rulePayloadNoPlatforms, keys, errors.Wrapf(ErrNoPlatforms,
+		"Publish request has no platform payloads: set at least one of %s", strings.Join(pn.platforms, ", ")))
+}
+
+// Checks `request` against the depth limit set with `WithMaxPayloadDepth`.
+func (pn *pushNotifications) validateDepth(request map[string]interface{}) error {
+	if pn.maxPayloadDepth > 0 && exceedsDepth(request, pn.maxPayloadDepth) {
+		return pn.validationFailed(rulePayloadTooDeep, pn.maxPayloadDepth, errors.Wrapf(ErrPayloadTooDeep,
+			"Publish request is nested more than %d levels deep", pn.maxPayloadDepth))
+	}
+
+	return nil
+}
+
+// Reports whether `value` has more than `maxDepth` levels of maps, slices or
+// structs, without looking any deeper than that.
+func exceedsDepth(value interface{}, maxDepth int) bool {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return false
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		if maxDepth == 0 {
+			return true
+		}
+		values := v.MapRange()
+		for values.Next() {
+			if exceedsDepth(values.Value().Interface(), maxDepth-1) {
+				return true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// Marshalled as a base64 string.
+			return false
+		}
+		if maxDepth == 0 {
+			return true
+		}
+		for i := 0; i < v.Len(); i++ {
+			if exceedsDepth(v.Index(i).Interface(), maxDepth-1) {
+				return true
+			}
+		}
+	case reflect.Struct:
+		if maxDepth == 0 {
+			return true
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).CanInterface() && exceedsDepth(v.Field(i).Interface(), maxDepth-1) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Checks that `interest` is a valid interest name, as `PublishToInterests`
+// does before publishing. Options such as `WithInterestPrefix` add further
+// checks on top of these. The length is checked against the default limit of
+// 164 characters, not one set with `WithMaxInterestLength`. The returned error
+// wraps `ErrInvalidInterestName`.
+func ValidateInterest(interest string) error {
+	_, err := interestError(interest, maxInterestLength)
+	return err
+}
+
+// Returns the rule `interest` breaks and an error describing it, or "" and
+// nil if it's valid. Interests can be at most `maxLength` characters long.
+func interestError(interest string, maxLength int) (string, error) {
+	switch {
+	case len(interest) == 0:
+		return ruleEmptyInterest, errors.Wrap(ErrInvalidInterestName, "An empty interest name is not valid")
+	case utf8.RuneCountInString(interest) > maxLength:
+		return ruleInterestTooLong, errors.Wrapf(ErrInvalidInterestName,
+			"Interest length is %d which is over %d characters", utf8.RuneCountInString(interest), maxLength)
+	case !interestValidationRegex.MatchString(interest):
+		return ruleInterestInvalidCharacters, errors.Wrapf(ErrInvalidInterestName,
+			"Interest `%s` contains an forbidden character: "+
+				"Allowed characters are: ASCII upper/lower-case letters, "+
+				"numbers or one of _-=@,.:",
+			printable(interest))
+	default:
+		return "", nil
+	}
+}
+
+// Checks that `userId` is a valid user id, as every method taking user ids
+// does. The returned error wraps `ErrInvalidUserId` or `ErrUserIdTooLong`.
+func ValidateUserId(userId string) error {
+	_, err := userIdError(userId)
+	return err
+}
+
+// Returns the rule `userId` breaks, or "" if it's valid. Callers describe
+// the rule in their own words, to give context such as the user id's index.
+func userIdRule(userId string) string {
+	switch {
+	case userId == "":
+		return ruleEmptyUserId
+	case utf8.RuneCountInString(userId) > maxUserIdLength:
+		return ruleUserIdTooLong
+	case !utf8.ValidString(userId):
+		return ruleUserIdInvalidUTF8
+	default:
+		return ""
+	}
+}
+
+// Returns the rule `userId` breaks and an error describing it, or "" and nil
+// if it's valid.
+func userIdError(userId string) (string, error) {
+	rule := userIdRule(userId)
+	switch rule {
+	case ruleEmptyUserId:
+		return rule, errors.Wrap(ErrInvalidUserId, "User Id cannot be empty")
+	case ruleUserIdTooLong:
+		return rule, errors.Wrapf(ErrUserIdTooLong,
+			"User Id ('%s') length too long (expected fewer than %d characters, got %d)",
+			userId, maxUserIdLength+1, utf8.RuneCountInString(userId))
+	case ruleUserIdInvalidUTF8:
+		return rule, errors.Wrap(ErrInvalidUserId, "User Id must be encoded using utf8")
+	default:
+		return "", nil
+	}
+}
+
+// A problem with one of the values given to a `Validate*` function.
+type ValidationError struct {
+	// The position of the invalid value in the slice that was validated,
+	// or -1 when the problem is with the slice as a whole.
+	Index int
+	// Why the value is invalid.
+	Reason string
+}
+
+func (e ValidationError) Error() string {
+	if e.Index < 0 {
+		return e.Reason
+	}
+
+	return fmt.Sprintf("Value at index %d is invalid: %s", e.Index, e.Reason)
+}
+
+// Checks `users` against the same rules as `PublishToUsers`, reporting every
+// problem found rather than just the first one. Returns an empty slice if
+// all the user ids are valid. The number of user ids is checked against the
+// default limit, not one set with `WithMaxUsersPerPublish`.
+func ValidateUsers(users []string) []ValidationError {
+	validationErrors := []ValidationError{}
+
+	if len(users) == 0 {
+		validationErrors = append(validationErrors, ValidationError{
+			Index:  -1,
+			Reason: "Must supply at least one user id",
+		})
+	}
+	if len(users) > MaxUsersPerPublish {
+		validationErrors = append(validationErrors, ValidationError{
+			Index:  -1,
+			Reason: fmt.Sprintf("Too many user ids supplied. API supports up to %d, got %d", MaxUsersPerPublish, len(users)),
+		})
+	}
+
+	for i, userId := range users {
+		var reason string
+		switch userIdRule(userId) {
+		case ruleEmptyUserId:
+			reason = "Empty user ids are not valid"
+		case ruleUserIdTooLong:
+			reason = fmt.Sprintf("User Id length too long (expected fewer than %d characters, got %d)", maxUserIdLength+1, utf8.RuneCountInString(userId))
+		case ruleUserIdInvalidUTF8:
+			reason = "User Id is not valid utf8"
+		default:
+			continue
+		}
+
+		validationErrors = append(validationErrors, ValidationError{Index: i, Reason: reason})
+	}
+
+	return validationErrors
+}
@@ -0,0 +1,387 @@
+package pushnotifications
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestValidateUsers(t *testing.T) {
+	Convey("Validating user ids", t, func() {
+		Convey("should report nothing for valid user ids", func() {
+			So(ValidateUsers([]string{"u-1", "u-2"}), ShouldBeEmpty)
+		})
+
+		Convey("should report every invalid user id with its index", func() {
+			tooLong := strings.Repeat("a", maxUserIdLength+1)
+			validationErrors := ValidateUsers([]string{"u-1", "", tooLong, string([]byte{192}), "u-5"})
+
+			So(validationErrors, ShouldHaveLength, 3)
+			So(validationErrors[0].Index, ShouldEqual, 1)
+			So(validationErrors[0].Reason, ShouldContainSubstring, "Empty user ids are not valid")
+			So(validationErrors[1].Index, ShouldEqual, 2)
+			So(validationErrors[1].Reason, ShouldContainSubstring, "User Id length too long")
+			So(validationErrors[2].Index, ShouldEqual, 3)
+			So(validationErrors[2].Reason, ShouldContainSubstring, "not valid utf8")
+			So(validationErrors[2].Error(), ShouldStartWith, "Value at index 3 is invalid")
+		})
+
+		Convey("should report problems with the whole slice alongside invalid user ids", func() {
+			users := make([]string, MaxUsersPerPublish+1)
+			validationErrors := ValidateUsers(users)
+
+			So(validationErrors, ShouldHaveLength, MaxUsersPerPublish+2)
+			So(validationErrors[0].Index, ShouldEqual, -1)
+			So(validationErrors[0].Error(), ShouldContainSubstring, "Too many user ids supplied")
+		})
+
+		Convey("should report an empty slice", func() {
+			validationErrors := ValidateUsers(nil)
+			So(validationErrors, ShouldHaveLength, 1)
+			So(validationErrors[0].Error(), ShouldEqual, "Must supply at least one user id")
+		})
+	})
+}
+
+func TestValidationLogging(t *testing.T) {
+	Convey("A Push Notifications Instance with a logger", t, func() {
+		logger := &captureLogger{}
+		pn, err := New(testInstanceId, testSecretKey, WithLogger(logger))
+		So(err, ShouldBeNil)
+
+		Convey("should log a validation failure with its rule and a redacted value", func() {
+			_, err := pn.PublishToInterests([]string{"secret#interest"}, testPublishRequest)
+			So(err, ShouldNotBeNil)
+
+			So(logger.messages("debug"), ShouldResemble, []string{
+				"Validation failed: rule=interest_invalid_characters value=secr***",
+			})
+		})
+
+		Convey("should log counts as they are", func() {
+			_, err := pn.PublishToUsers(nil, testPublishRequest)
+			So(err, ShouldNotBeNil)
+
+			So(logger.messages("debug"), ShouldResemble, []string{
+				"Validation failed: rule=no_users value=0",
+			})
+		})
+
+		Convey("should not log anything for valid input", func() {
+			_, err := pn.GenerateToken("u-123")
+			So(err, ShouldBeNil)
+			So(logger.messages("debug"), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestValidationSentinelErrors(t *testing.T) {
+	Convey("Invalid arguments", t, func() {
+		pn, err := New(testInstanceId, testSecretKey, WithInterestPrefix("app-"))
+		So(err, ShouldBeNil)
+
+		tooManyInterests := make([]string, 101)
+		for i := range tooManyInterests {
+			tooManyInterests[i] = "app-interest"
+		}
+		tooManyUsers := make([]string, MaxUsersPerPublish+1)
+		for i := range tooManyUsers {
+			tooManyUsers[i] = "u-1"
+		}
+		tooLongUserId := strings.Repeat("a", maxUserIdLength+1)
+
+		Convey("should be reported with sentinel errors when publishing to interests", func() {
+			cases := map[error][][]string{
+				ErrNoInterests:         {{}},
+				ErrTooManyInterests:    {tooManyInterests},
+				ErrInvalidInterestName: {{""}, {"app-" + strings.Repeat("a", 164)}, {"app-a b"}, {"other"}},
+			}
+			for sentinel, interestLists := range cases {
+				for _, interests := range interestLists {
+					_, err := pn.PublishToInterests(interests, testPublishRequest)
+					So(errors.Is(err, sentinel), ShouldBeTrue)
+				}
+			}
+		})
+
+		Convey("should be reported with sentinel errors when publishing to users", func() {
+			cases := map[error][][]string{
+				ErrNoUsers:       {{}},
+				ErrTooManyUsers:  {tooManyUsers},
+				ErrInvalidUserId: {{""}, {string([]byte{192})}},
+				ErrUserIdTooLong: {{tooLongUserId}},
+			}
+			for sentinel, userLists := range cases {
+				for _, users := range userLists {
+					_, err := pn.PublishToUsers(users, testPublishRequest)
+					So(errors.Is(err, sentinel), ShouldBeTrue)
+				}
+			}
+		})
+
+		Convey("should be reported with sentinel errors when generating tokens and deleting users", func() {
+			_, err := pn.GenerateToken("")
+			So(errors.Is(err, ErrInvalidUserId), ShouldBeTrue)
+			_, err = pn.GenerateToken(tooLongUserId)
+			So(errors.Is(err, ErrUserIdTooLong), ShouldBeTrue)
+
+			So(errors.Is(pn.DeleteUser(""), ErrInvalidUserId), ShouldBeTrue)
+			So(errors.Is(pn.DeleteUser(tooLongUserId), ErrUserIdTooLong), ShouldBeTrue)
+			So(errors.Is(pn.DeleteUser(string([]byte{192})), ErrInvalidUserId), ShouldBeTrue)
+		})
+
+		Convey("should keep their detailed messages", func() {
+			_, err := pn.PublishToInterests(tooManyInterests, testPublishRequest)
+			So(err.Error(), ShouldStartWith, "Too many interests supplied (101): API only supports up to 100")
+			So(errors.Is(err, ErrNoInterests), ShouldBeFalse)
+		})
+	})
+}
+
+func TestInterestValidationPattern(t *testing.T) {
+	Convey("The interest validation pattern", t, func() {
+		Convey("should be the pattern interests are validated with", func() {
+			So(InterestValidationPattern(), ShouldEqual, `^[a-zA-Z0-9_\-=@,.;]+$`)
+
+			pattern := regexp.MustCompile(InterestValidationPattern())
+			So(pattern.MatchString("hello-world_1"), ShouldBeTrue)
+			So(pattern.MatchString("hello world"), ShouldBeFalse)
+		})
+	})
+}
+
+func TestMaxPayloadDepth(t *testing.T) {
+	Convey("A Push Notifications Instance with a max payload depth", t, func() {
+		var requests int
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Write([]byte(`{"publishId":"pub-123"}`))
+		}))
+		defer testServer.Close()
+
+		pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL), WithMaxPayloadDepth(4))
+		So(err, ShouldBeNil)
+
+		nested := func(depth int) map[string]interface{} {
+			data := map[string]interface{}{"value": 1}
+			for i := 2; i < depth; i++ {
+				data = map[string]interface{}{"nested": data}
+			}
+			return map[string]interface{}{"fcm": data}
+		}
+
+		Convey("should reject a request nested too deeply before sending it", func() {
+			_, err := pn.PublishToInterests([]string{"hello"}, nested(5))
+			So(errors.Is(err, ErrPayloadTooDeep), ShouldBeTrue)
+			So(err.Error(), ShouldContainSubstring, "nested more than 4 levels deep")
+
+			_, err = pn.PublishToUsers([]string{"u-123"}, nested(500))
+			So(errors.Is(err, ErrPayloadTooDeep), ShouldBeTrue)
+			So(requests, ShouldEqual, 0)
+		})
+
+		Convey("should count slices as levels", func() {
+			request := map[string]interface{}{
+				"fcm": map[string]interface{}{
+					"data": map[string]interface{}{"list": []interface{}{map[string]interface{}{}}},
+				},
+			}
+			_, err := pn.PublishToInterests([]string{"hello"}, request)
+			So(errors.Is(err, ErrPayloadTooDeep), ShouldBeTrue)
+		})
+
+		Convey("should accept a shallow enough request", func() {
+			_, err := pn.PublishToInterests([]string{"hello"}, nested(4))
+			So(err, ShouldBeNil)
+			So(requests, ShouldEqual, 1)
+		})
+
+		Convey("should not create an instance with a non-positive depth", func() {
+			pn, err := New(testInstanceId, testSecretKey, WithMaxPayloadDepth(0))
+			So(pn, ShouldBeNil)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestPlatformValidation(t *testing.T) {
+	Convey("A Push Notifications Instance checking for platform payloads", t, func() {
+		var requests int
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Write([]byte(`{"publishId":"pub-123"}`))
+		}))
+		defer testServer.Close()
+
+		pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL))
+		So(err, ShouldBeNil)
+
+		Convey("should reject a request without a platform payload before sending it", func() {
+			request := map[string]interface{}{"notification": map[string]interface{}{"title": "Hello"}}
+			_, err := pn.PublishToInterests([]string{"hello"}, request)
+			So(errors.Is(err, ErrNoPlatforms), ShouldBeTrue)
+			So(err.Error(), ShouldContainSubstring, "set at least one of apns, fcm, web")
+
+			_, err = pn.PublishToUsers([]string{"u-123"}, map[string]interface{}{})
+			So(errors.Is(err, ErrNoPlatforms), ShouldBeTrue)
+			So(requests, ShouldEqual, 0)
+		})
+
+		Convey("should accept the platforms set with `WithPlatforms`", func() {
+			pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL), WithPlatforms("fcm", "hms"))
+			So(err, ShouldBeNil)
+
+			_, err = pn.PublishToInterests([]string{"hello"}, map[string]interface{}{"hms": map[string]interface{}{}})
+			So(err, ShouldBeNil)
+			So(requests, ShouldEqual, 1)
+
+			_, err = pn.PublishToInterests([]string{"hello"}, map[string]interface{}{"web": map[string]interface{}{}})
+			So(errors.Is(err, ErrNoPlatforms), ShouldBeTrue)
+		})
+
+		Convey("should not create an instance without any platforms", func() {
+			for _, platforms := range [][]string{{}, {"fcm", ""}} {
+				pn, err := New(testInstanceId, testSecretKey, WithPlatforms(platforms...))
+				So(pn, ShouldBeNil)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestMaxPayloadBytes(t *testing.T) {
+	Convey("A Push Notifications Instance with a max payload size", t, func() {
+		var requests int
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Write([]byte(`{"publishId":"pub-123"}`))
+		}))
+		defer testServer.Close()
+
+		withBody := func(size int) map[string]interface{} {
+			// `{"fcm":{"data":{"body":""}}}` is 28 bytes.
+			return map[string]interface{}{
+				"fcm": map[string]interface{}{"data": map[string]interface{}{"body": strings.Repeat("a", size-28)}},
+			}
+		}
+
+		Convey("should reject a request over 4KB by default, before sending it", func() {
+			pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL))
+			So(err, ShouldBeNil)
+
+			_, err = pn.PublishToInterests([]string{"hello"}, withBody(4097))
+			So(errors.Is(err, ErrPayloadTooLarge), ShouldBeTrue)
+			So(err.Error(), ShouldContainSubstring, "is 4097 bytes, over the limit of 4096 bytes")
+
+			_, err = pn.PublishRawToUsers([]string{"u-123"}, json.RawMessage(`{"fcm":{"data":{"body":"`+strings.Repeat("a", 4096)+`"}}}`))
+			So(errors.Is(err, ErrPayloadTooLarge), ShouldBeTrue)
+			So(requests, ShouldEqual, 0)
+		})
+
+		Convey("should not count the interests or user ids", func() {
+			pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL))
+			So(err, ShouldBeNil)
+
+			users := make([]string, 100)
+			for i := range users {
+				users[i] = fmt.Sprintf("user-%03d", i)
+			}
+			_, err = pn.PublishToUsers(users, withBody(4096))
+			So(err, ShouldBeNil)
+			So(requests, ShouldEqual, 1)
+		})
+
+		Convey("should use the limit set with `WithMaxPayloadBytes`", func() {
+			pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL), WithMaxPayloadBytes(64))
+			So(err, ShouldBeNil)
+
+			_, err = pn.PublishToInterests([]string{"hello"}, withBody(65))
+			So(errors.Is(err, ErrPayloadTooLarge), ShouldBeTrue)
+			_, err = pn.PublishToInterests([]string{"hello"}, withBody(64))
+			So(err, ShouldBeNil)
+		})
+
+		Convey("should not create an instance with a non-positive limit", func() {
+			pn, err := New(testInstanceId, testSecretKey, WithMaxPayloadBytes(0))
+			So(pn, ShouldBeNil)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestLengthsInCharacters(t *testing.T) {
+	Convey("Interest and user id lengths", t, func() {
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"publishId":"pub-123"}`))
+		}))
+		defer testServer.Close()
+
+		pn, err := New(testInstanceId, testSecretKey, WithCustomBaseURL(testServer.URL))
+		So(err, ShouldBeNil)
+
+		Convey("should count user ids in characters, not bytes", func() {
+			userId := strings.Repeat("é", maxUserIdLength)
+
+			_, err := pn.PublishToUsers([]string{userId}, testPublishRequest)
+			So(err, ShouldBeNil)
+			_, err = pn.GenerateToken(userId)
+			So(err, ShouldBeNil)
+			So(pn.DeleteUser(userId), ShouldBeNil)
+			So(ValidateUsers([]string{userId}), ShouldBeEmpty)
+
+			_, err = pn.GenerateToken(userId + "é")
+			So(errors.Is(err, ErrUserIdTooLong), ShouldBeTrue)
+			So(err.Error(), ShouldContainSubstring, fmt.Sprintf("got %d", maxUserIdLength+1))
+		})
+
+		Convey("should count interests in characters, not bytes", func() {
+			_, err := pn.PublishToInterests([]string{strings.Repeat("é", 100)}, testPublishRequest)
+			So(errors.Is(err, ErrInvalidInterestName), ShouldBeTrue)
+			So(err.Error(), ShouldNotContainSubstring, "over 164 characters")
+
+			_, err = pn.PublishToInterests([]string{strings.Repeat("é", 165)}, testPublishRequest)
+			So(err.Error(), ShouldContainSubstring, "Interest length is 165 which is over 164 characters")
+		})
+	})
+}
+
+func TestValidateInterestAndUserId(t *testing.T) {
+	Convey("ValidateInterest", t, func() {
+		So(ValidateInterest("hello-world_=@,.;"), ShouldBeNil)
+
+		for _, interest := range []string{"", "bad interest", strings.Repeat("a", 165)} {
+			err := ValidateInterest(interest)
+			So(errors.Is(err, ErrInvalidInterestName), ShouldBeTrue)
+		}
+
+		Convey("should fail the same way as PublishToInterests", func() {
+			pn, err := New(testInstanceId, testSecretKey)
+			So(err, ShouldBeNil)
+
+			_, err = pn.PublishToInterests([]string{"bad interest"}, testPublishRequest)
+			So(err.Error(), ShouldEqual, ValidateInterest("bad interest").Error())
+		})
+	})
+
+	Convey("ValidateUserId", t, func() {
+		So(ValidateUserId("u-123"), ShouldBeNil)
+		So(errors.Is(ValidateUserId(""), ErrInvalidUserId), ShouldBeTrue)
+		So(errors.Is(ValidateUserId(string([]byte{0xff})), ErrInvalidUserId), ShouldBeTrue)
+		So(errors.Is(ValidateUserId(strings.Repeat("a", maxUserIdLength+1)), ErrUserIdTooLong), ShouldBeTrue)
+
+		Convey("should fail the same way as GenerateToken", func() {
+			pn, err := New(testInstanceId, testSecretKey)
+			So(err, ShouldBeNil)
+
+			_, err = pn.GenerateToken(string([]byte{0xff}))
+			So(err.Error(), ShouldEqual, ValidateUserId(string([]byte{0xff})).Error())
+		})
+	})
+}